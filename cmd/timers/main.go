@@ -0,0 +1,307 @@
+/** Inspects and converts timer log files.
+
+    Usage:
+        timers summary [-by key,...] file...
+        timers dump file...
+        timers validate file...
+        timers report [-width 40] file...
+        timers compare [-alpha 0.05] [-by key,...] before-file... -- after-file...
+        timers export [-format csv|jsonl|trace|otlp-json|otlp-proto] [-rows events|intervals] [-service name] file...
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samkumar/go-timers/timers"
+	)
+
+const USAGE string = `usage: timers <command> [flags] file...
+
+commands:
+  summary   per-timer count, min, mean, percentiles and max
+  dump      every record in a readable form
+  validate  report starts and ends that can't be paired
+  report    latency histograms and a tree of nested timers, as text
+  compare   compare two runs and flag significant changes
+  export    convert to CSV, JSON Lines, Chrome trace events or OTLP
+`
+
+/* Exit codes */
+const (
+	EXIT_OK int = 0
+	EXIT_ANOMALIES int = 1 // validate found anomalies
+	EXIT_ERROR int = 2
+	EXIT_REGRESSION int = 3 // compare found a significant regression
+	)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type command func(args []string, stdout io.Writer, stderr io.Writer) int
+
+var commands map[string]command = map[string]command{
+	"summary": summary,
+	"dump": dump,
+	"validate": validate,
+	"report": report,
+	"compare": compare,
+	"export": export,
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) (code int) {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, USAGE)
+		return EXIT_ERROR
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "timers: unknown command %q\n%s", args[0], USAGE)
+		return EXIT_ERROR
+	}
+	// Anomalies go to stderr, so that they don't end up in the output.
+	timers.SetAnomalyReporter(func (a timers.Anomaly) {
+		fmt.Fprintf(stderr, "timers %s: %v\n", args[0], a)
+	})
+	// The parsing functions panic on files they can't read.
+	defer func () {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "timers %s: %v\n", args[0], r)
+			code = EXIT_ERROR
+		}
+	}()
+	return cmd(args[1:], stdout, stderr)
+}
+
+/** Parses the flags and returns the files named after them, or nil after
+    reporting a usage error. */
+func parseFlags(flags *flag.FlagSet, args []string, stderr io.Writer) []string {
+	flags.SetOutput(stderr)
+	if flags.Parse(args) != nil {
+		return nil
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(stderr, "timers %s: no log files given\n", flags.Name())
+		return nil
+	}
+	return flags.Args()
+}
+
+func summary(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("summary", flag.ContinueOnError)
+	var by *string = flags.String("by", "", "comma-separated label keys to group by")
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	var deltamap map[string][]int64 = parseDeltas(files, *by)
+	var names []string = make([]string, 0, len(deltamap))
+	for name := range deltamap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var w *tabwriter.Writer = tabwriter.NewWriter(stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "name\tcount\tmin\tmean\tp50\tp90\tp99\tmax\t")
+	for _, name := range names {
+		var stats timers.DeltaStats = timers.SummarizeDeltas(deltamap[name])
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\t%v\t%v\t\n", name, stats.Count, time.Duration(stats.Min),
+			time.Duration(stats.Mean).Round(time.Nanosecond), time.Duration(stats.P50), time.Duration(stats.P90),
+			time.Duration(stats.P99), time.Duration(stats.Max))
+	}
+	w.Flush()
+	return EXIT_OK
+}
+
+/** Groups by the comma-separated label keys in by, if there are any. */
+func parseDeltas(files []string, by string) map[string][]int64 {
+	var tmap map[string]*timers.TimerSummary = timers.ParseFileToMap(files)
+	if by == "" {
+		return timers.ParseMapToDeltas(tmap)
+	}
+	return timers.ParseMapToDeltasByLabels(tmap, strings.Split(by, ",")...)
+}
+
+func dump(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("dump", flag.ContinueOnError)
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	var source string = ""
+	for _, event := range timers.ParseFileToEvents(files) {
+		if event.Source != source {
+			source = event.Source
+			fmt.Fprintf(stdout, "== %s\n", source)
+		}
+		var line string = fmt.Sprintf("%s %-6s", time.Unix(0, event.Time).UTC().Format(time.RFC3339Nano), event.Kind)
+		if event.Name != "" {
+			line += " " + event.Name
+		}
+		if event.ID != 0 {
+			line += fmt.Sprintf(" #%d", event.ID)
+		}
+		if event.Outcome != "" {
+			line += " outcome=" + event.Outcome
+		}
+		var keys []string = make([]string, 0, len(event.Labels))
+		for k := range event.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			line += fmt.Sprintf(" %s=%q", k, event.Labels[k])
+		}
+		if event.Kind == timers.EVENT_LAP {
+			line += fmt.Sprintf(" lap=%q", event.Lap)
+		} else if event.Kind == timers.EVENT_HEADER {
+			line += fmt.Sprintf(" host=%q pid=%d", event.Host, event.PID)
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return EXIT_OK
+}
+
+func validate(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("validate", flag.ContinueOnError)
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	var anomalies []timers.Anomaly = timers.FindAnomalies(timers.ParseFileToMap(files))
+	for _, anomaly := range anomalies {
+		fmt.Fprintln(stdout, anomaly)
+	}
+	if len(anomalies) != 0 {
+		fmt.Fprintf(stdout, "%d anomalies\n", len(anomalies))
+		return EXIT_ANOMALIES
+	}
+	fmt.Fprintln(stdout, "ok")
+	return EXIT_OK
+}
+
+func report(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("report", flag.ContinueOnError)
+	var width *int = flags.Int("width", timers.DEFAULT_REPORT_WIDTH, "width of the bars")
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	if err := timers.WriteLogReport(stdout, files, *width); err != nil {
+		fmt.Fprintf(stderr, "timers report: %v\n", err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
+
+func compare(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("compare", flag.ContinueOnError)
+	var alpha *float64 = flags.Float64("alpha", timers.DEFAULT_ALPHA, "significance level")
+	var by *string = flags.String("by", "", "comma-separated label keys to group by")
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	var split int = -1
+	for i, file := range files {
+		if file == "--" {
+			split = i
+			break
+		}
+	}
+	if split <= 0 || split == len(files) - 1 {
+		fmt.Fprintln(stderr, "timers compare: expected before-file... -- after-file...")
+		return EXIT_ERROR
+	}
+	var comparisons []timers.TimerComparison = timers.CompareDeltas(parseDeltas(files[:split], *by), parseDeltas(files[split + 1:], *by), *alpha)
+	var regressed bool = false
+	var w *tabwriter.Writer = tabwriter.NewWriter(stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "name\tbefore\tafter\tmean\tchange\tp50\tp99\tp-value\t\t")
+	for _, c := range comparisons {
+		var verdict string = ""
+		if c.Regression {
+			verdict = "REGRESSION"
+			regressed = true
+		} else if c.Improvement {
+			verdict = "improvement"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%v -> %v\t%s\t%s\t%s\t%.3g\t%s\t\n", c.Name, c.Before.Count, c.After.Count,
+			time.Duration(c.Mean.Before).Round(time.Nanosecond), time.Duration(c.Mean.After).Round(time.Nanosecond),
+			percentChange(c.Mean), percentChange(c.P50), percentChange(c.P99), c.PValue, verdict)
+	}
+	w.Flush()
+	if regressed {
+		return EXIT_REGRESSION
+	}
+	return EXIT_OK
+}
+
+func percentChange(change timers.StatChange) string {
+	if change.Before == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", 100 * change.Relative)
+}
+
+/** Lets the OTLP exporter write straight to stdout. */
+type writerSink struct {
+	writer io.Writer
+}
+
+func (sink writerSink) ExportSpans(payload []byte, contentType string) error {
+	_, err := sink.writer.Write(payload)
+	return err
+}
+
+func export(args []string, stdout io.Writer, stderr io.Writer) int {
+	var flags *flag.FlagSet = flag.NewFlagSet("export", flag.ContinueOnError)
+	var format *string = flags.String("format", "csv", "csv, jsonl, trace, otlp-json or otlp-proto")
+	var rows *string = flags.String("rows", "intervals", "events or intervals, for csv and jsonl")
+	var service *string = flags.String("service", "timers", "service name for OTLP")
+	var files []string = parseFlags(flags, args, stderr)
+	if files == nil {
+		return EXIT_ERROR
+	}
+	if *rows != "events" && *rows != "intervals" {
+		fmt.Fprintf(stderr, "timers export: unknown rows %q\n", *rows)
+		return EXIT_ERROR
+	}
+	var err error
+	switch *format {
+	case "csv":
+		if *rows == "events" {
+			err = timers.WriteEventsCSV(stdout, timers.ParseFileToEvents(files))
+		} else {
+			err = timers.WriteIntervalsCSV(stdout, timers.ParseFilesToIntervals(files))
+		}
+	case "jsonl":
+		if *rows == "events" {
+			err = timers.WriteEventsJSONLines(stdout, timers.ParseFileToEvents(files))
+		} else {
+			err = timers.WriteIntervalsJSONLines(stdout, timers.ParseFilesToIntervals(files))
+		}
+	case "trace":
+		err = timers.WriteLogTraceEvents(stdout, files)
+	case "otlp-json", "otlp-proto":
+		var exporter *timers.SpanExporter = &timers.SpanExporter{ServiceName: *service, Format: timers.OTLP_JSON, Sink: writerSink{stdout}}
+		if *format == "otlp-proto" {
+			exporter.Format = timers.OTLP_PROTOBUF
+		}
+		err = exporter.ExportFiles(files)
+	default:
+		fmt.Fprintf(stderr, "timers export: unknown format %q\n", *format)
+		return EXIT_ERROR
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "timers export: %v\n", err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
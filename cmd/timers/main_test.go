@@ -0,0 +1,174 @@
+package main
+
+import "bytes"
+import "encoding/binary"
+import "encoding/csv"
+import "encoding/json"
+import "fmt"
+import "os"
+import "strings"
+import "testing"
+import "time"
+
+import "github.com/samkumar/go-timers/timers"
+
+func writeCLILog() {
+	timers.SetLogFile("/home/sam/timers/clilog")
+	timers.StartLogTimer("legacy")
+	var h *timers.Handle = timers.StartLogHandle("request")
+	h.EndWithLabels(timers.Labels{"endpoint": "/users"})
+	timers.EndLogTimer("legacy")
+	timers.StartLogHandle("dangling")
+	timers.CloseLogFile()
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	var code int = run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI1(t *testing.T) {
+	writeCLILog()
+	code, out, errout := runCLI("summary", "-by", "endpoint", "/home/sam/timers/clilog")
+	if code != EXIT_OK || !strings.Contains(out, "request{endpoint=/users}") || !strings.Contains(out, "legacy{endpoint=}") {
+		t.Logf("Bad summary %d:\n%s", code, out)
+		t.Fail()
+	}
+	if strings.Contains(out, "dangling") || !strings.Contains(errout, "dangling instance") {
+		t.Logf("Anomaly not sent to stderr:\n%s", out)
+		t.Fail()
+	}
+	code, out, _ = runCLI("dump", "/home/sam/timers/clilog")
+	hostname, _ := os.Hostname()
+	if code != EXIT_OK || strings.Count(out, "\n") != 8 || !strings.Contains(out, fmt.Sprintf(" header host=%q pid=%d\n", hostname, os.Getpid())) || !strings.Contains(out, "labels request #") || !strings.Contains(out, `endpoint="/users"`) {
+		t.Logf("Bad dump %d:\n%s", code, out)
+		t.Fail()
+	}
+	code, out, errout = runCLI("report", "-width", "10", "/home/sam/timers/clilog")
+	if code != EXIT_OK || !strings.Contains(out, "request (n=1,") || !strings.Contains(out, "|@@@@@@@@@@|") || !strings.Contains(out, "\nlegacy ") ||
+		strings.Contains(out, "dangling") || strings.Count(errout, "dangling") != 1 {
+		t.Logf("Bad report %d:\n%s", code, out)
+		t.Fail()
+	}
+	code, out, _ = runCLI("validate", "/home/sam/timers/clilog")
+	if code != EXIT_ANOMALIES || !strings.Contains(out, "was started but never ended") || !strings.HasSuffix(out, "1 anomalies\n") {
+		t.Logf("Bad validation %d:\n%s", code, out)
+		t.Fail()
+	}
+	var parsers map[string]func(string) bool = map[string]func(string) bool{
+		"jsonl": func (out string) bool {
+			var decoder *json.Decoder = json.NewDecoder(strings.NewReader(out))
+			var count int = 0
+			for decoder.More() {
+				var event timers.Event
+				if decoder.Decode(&event) != nil {
+					return false
+				}
+				count++
+			}
+			return count == 7
+		},
+		"csv": func (out string) bool {
+			records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+			return err == nil && len(records) == 3 && records[0][0] == "name"
+		},
+		"trace": func (out string) bool {
+			var trace struct {
+				TraceEvents []json.RawMessage `json:"traceEvents"`
+			}
+			return json.Unmarshal([]byte(out), &trace) == nil && len(trace.TraceEvents) != 0
+		},
+		"otlp-json": func (out string) bool {
+			var request map[string]interface{}
+			return json.Unmarshal([]byte(out), &request) == nil && request["resourceSpans"] != nil
+		},
+		"otlp-proto": func (out string) bool {
+			return isProtoMessage([]byte(out))
+		},
+	}
+	for format, parse := range parsers {
+		var rows string = "intervals"
+		var anomalies int = 1
+		if format == "jsonl" {
+			rows, anomalies = "events", 0 // events aren't paired
+		}
+		code, out, errout = runCLI("export", "-format", format, "-rows", rows, "/home/sam/timers/clilog")
+		if code != EXIT_OK || !parse(out) || strings.Count(errout, "dangling") != anomalies {
+			t.Logf("Bad export to %s %d:\n%q\n%s", format, code, out, errout)
+			t.Fail()
+		}
+	}
+}
+
+/** Checks that b is a sequence of length-delimited protobuf fields. */
+func isProtoMessage(b []byte) bool {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 || tag & 7 != 2 {
+			return false
+		}
+		length, m := binary.Uvarint(b[n:])
+		if m <= 0 || uint64(len(b) - n - m) < length {
+			return false
+		}
+		b = b[n + m + int(length):]
+	}
+	return true
+}
+
+func TestCLI2(t *testing.T) {
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/clitruncated")
+	f.Write([]byte("name\x00s\x01\x02"))
+	f.Close()
+	var cases [][]string = [][]string{
+		nil,
+		[]string{"bogus"},
+		[]string{"summary"},
+		[]string{"export", "-format", "xml", "/home/sam/timers/clitruncated"},
+		[]string{"validate", "/home/sam/timers/clitruncated"},
+		[]string{"dump", "/home/sam/timers/nonexistent"},
+	}
+	for _, args := range cases {
+		if code, _, errout := runCLI(args...); code != EXIT_ERROR || errout == "" {
+			t.Logf("Arguments %v gave %d", args, code)
+			t.Fail()
+		}
+	}
+}
+
+func TestCLI3(t *testing.T) {
+	timers.SetLogFile("/home/sam/timers/clibefore")
+	for i := 0; i < 10; i++ {
+		timers.StartLogTimer("work")
+		timers.EndLogTimer("work")
+	}
+	timers.CloseLogFile()
+	timers.SetLogFile("/home/sam/timers/cliafter")
+	for i := 0; i < 10; i++ {
+		timers.StartLogTimer("work")
+		time.Sleep(time.Millisecond)
+		timers.EndLogTimer("work")
+	}
+	timers.StartLogHandle("dangling")
+	timers.CloseLogFile()
+	code, out, errout := runCLI("compare", "/home/sam/timers/clibefore", "--", "/home/sam/timers/cliafter")
+	if code != EXIT_REGRESSION || !strings.Contains(out, "REGRESSION") {
+		t.Logf("Regression not flagged %d:\n%s", code, out)
+		t.Fail()
+	}
+	if strings.Contains(out, "dangling") || !strings.Contains(errout, "dangling") {
+		t.Logf("Anomaly mixed into the comparison:\n%s", out)
+		t.Fail()
+	}
+	code, out, _ = runCLI("compare", "/home/sam/timers/cliafter", "--", "/home/sam/timers/clibefore")
+	if code != EXIT_OK || !strings.Contains(out, "improvement") {
+		t.Logf("Improvement not reported %d:\n%s", code, out)
+		t.Fail()
+	}
+	if code, _, _ = runCLI("compare", "/home/sam/timers/clibefore"); code != EXIT_ERROR {
+		t.Log("Missing separator was accepted")
+		t.Fail()
+	}
+}
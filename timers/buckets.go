@@ -0,0 +1,81 @@
+package timers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	)
+
+/* TIME-WINDOW BUCKETS
+   Splits each timer's intervals into fixed windows by end time, giving a time
+   series that shows warm-up and degradation over a run. Windows are aligned to
+   multiples of their length since the Unix epoch, so the series of different
+   timers line up. */
+
+type Bucket struct {
+	Start int64 // inclusive
+	End int64 // exclusive
+	Stats DeltaStats // of the intervals that ended in the window
+	Rate float64 // intervals ended per second
+}
+
+func windowStart(t int64, window int64) int64 {
+	var start int64 = t - t % window
+	if t % window < 0 {
+		start -= window
+	}
+	return start
+}
+
+/** The most windows a timer's series is filled out to; see BucketIntervals. */
+const MAX_BUCKETS int64 = 100000
+
+/** Returns one series per timer, in time order, from the window of its first
+    interval to that of its last. Windows in between in which no interval ended
+    are included with a count of 0, so that stalls show up in the series. A
+    series that would span more than MAX_BUCKETS windows, e.g. because of a
+    single outlier, keeps only the windows in which an interval ended, so that
+    it can't exhaust memory; there a missing window had no intervals. */
+func BucketIntervals(intervals []Interval, window time.Duration) map[string][]Bucket {
+	if window <= 0 {
+		panic(fmt.Sprintf("Attempted to bucket intervals into windows of %v", window))
+	}
+	var w int64 = int64(window)
+	var deltas map[string]map[int64][]int64 = make(map[string]map[int64][]int64)
+	for _, interval := range intervals {
+		byWindow, ok := deltas[interval.Name]
+		if !ok {
+			byWindow = make(map[int64][]int64)
+			deltas[interval.Name] = byWindow
+		}
+		var start int64 = windowStart(interval.End, w)
+		byWindow[start] = append(byWindow[start], interval.Delta())
+	}
+	var series map[string][]Bucket = make(map[string][]Bucket)
+	for name, byWindow := range deltas {
+		var starts []int64 = make([]int64, 0, len(byWindow))
+		for start := range byWindow {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func (i int, j int) bool { return starts[i] < starts[j] })
+		var first, last int64 = starts[0], starts[len(starts) - 1]
+		if span := last - first; span >= 0 && span / w < MAX_BUCKETS {
+			starts = starts[:0]
+			for start := first; start <= last; start += w {
+				starts = append(starts, start)
+			}
+		}
+		var buckets []Bucket = make([]Bucket, 0, len(starts))
+		for _, start := range starts {
+			var stats DeltaStats = SummarizeDeltas(byWindow[start])
+			buckets = append(buckets, Bucket{start, start + w, stats, float64(stats.Count) / window.Seconds()})
+		}
+		series[name] = buckets
+	}
+	return series
+}
+
+/** Buckets the completed intervals in tmap, as paired by ParseMapToIntervals. */
+func ParseMapToBuckets(tmap map[string]*TimerSummary, window time.Duration) map[string][]Bucket {
+	return BucketIntervals(ParseMapToIntervals(tmap), window)
+}
@@ -0,0 +1,59 @@
+package timers
+
+import "testing"
+import "time"
+
+func TestBuckets1(t *testing.T) {
+	var s int64 = int64(time.Second)
+	var intervals []Interval = []Interval{
+		Interval{Name: "req", Start: 10 * s - 5, End: 10 * s + 5},
+		Interval{Name: "req", Start: 10 * s, End: 10 * s + 30},
+		Interval{Name: "req", Start: 12 * s, End: 13 * s - 1},
+		Interval{Name: "gc", Start: 0, End: 11 * s},
+	}
+	var series map[string][]Bucket = BucketIntervals(intervals, time.Second)
+	var req []Bucket = series["req"]
+	if len(series) != 2 || len(req) != 3 || len(series["gc"]) != 1 {
+		t.Logf("Bad series %v", series)
+		t.Fail()
+		return
+	}
+	if req[0].Start != 10 * s || req[0].End != 11 * s || req[0].Stats.Count != 2 || req[0].Stats.Max != 30 || req[0].Rate != 2 {
+		t.Logf("Bad first bucket %+v", req[0])
+		t.Fail()
+	}
+	if req[1].Start != 11 * s || req[1].Stats.Count != 0 || req[1].Rate != 0 ||
+		req[2].Start != 12 * s || req[2].Stats.Count != 1 || req[2].Stats.P50 != s - 1 {
+		t.Logf("Bad later buckets %+v", req[1:])
+		t.Fail()
+	}
+	var outlier []Bucket = BucketIntervals([]Interval{Interval{Name: "x", End: 0}, Interval{Name: "x", End: 1 << 62}}, time.Nanosecond)["x"]
+	if len(outlier) != 2 || outlier[1].Start != 1 << 62 {
+		t.Logf("Bad series around an outlier %v", outlier)
+		t.Fail()
+	}
+	series = BucketIntervals(intervals, time.Minute)
+	if len(series["req"]) != 1 || series["req"][0].Start != 0 || series["req"][0].Rate != 3.0 / 60 {
+		t.Logf("Bad minute buckets %v", series["req"])
+		t.Fail()
+	}
+	if windowStart(-1, 10) != -10 || windowStart(-10, 10) != -10 || windowStart(9, 10) != 0 {
+		t.Log("Windows are not aligned below zero")
+		t.Fail()
+	}
+}
+
+func TestBuckets2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+		}()
+	if len(ParseMapToBuckets(map[string]*TimerSummary{}, time.Second)) != 0 {
+		t.Fail()
+	}
+	finished = true
+	BucketIntervals(nil, 0)
+}
@@ -0,0 +1,139 @@
+package timers
+
+import (
+	"math"
+	"sort"
+	)
+
+/* COMPARING RUNS
+   Compares the deltas of two runs of the same workload, timer by timer, and
+   uses a two-sided Mann-Whitney U test to tell real changes from noise. The
+   test makes no assumption about how the deltas are distributed, which suits
+   timings with long tails. */
+
+const DEFAULT_ALPHA float64 = 0.05
+
+type StatChange struct {
+	Before float64
+	After float64
+	Absolute float64 // After - Before
+	Relative float64 // Absolute / Before, or 0 if Before is 0
+}
+
+func newStatChange(before float64, after float64) StatChange {
+	var change StatChange = StatChange{Before: before, After: after, Absolute: after - before}
+	if before != 0 {
+		change.Relative = change.Absolute / before
+	}
+	return change
+}
+
+type TimerComparison struct {
+	Name string
+	Before DeltaStats
+	After DeltaStats
+	Mean StatChange
+	P50 StatChange
+	P90 StatChange
+	P99 StatChange
+	U float64 // pairs in which the after delta is larger, counting ties as half
+	Z float64 // positive if the after deltas tend to be larger
+	PValue float64 // 1 if either run has no deltas for the timer
+	Regression bool // significantly slower after
+	Improvement bool // significantly faster after
+}
+
+/** Compares every timer that appears in either map, as returned by
+    ParseMapToDeltas. A change is significant if its p-value is below alpha.
+    The result is ordered by name. */
+func CompareDeltas(before map[string][]int64, after map[string][]int64, alpha float64) []TimerComparison {
+	var names []string = make([]string, 0, len(before) + len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var comparisons []TimerComparison = make([]TimerComparison, len(names))
+	for i, name := range names {
+		comparisons[i] = compareTimer(name, before[name], after[name], alpha)
+	}
+	return comparisons
+}
+
+func compareTimer(name string, before []int64, after []int64, alpha float64) TimerComparison {
+	var c TimerComparison = TimerComparison{Name: name, Before: SummarizeDeltas(before), After: SummarizeDeltas(after)}
+	c.Mean = newStatChange(c.Before.Mean, c.After.Mean)
+	c.P50 = newStatChange(float64(c.Before.P50), float64(c.After.P50))
+	c.P90 = newStatChange(float64(c.Before.P90), float64(c.After.P90))
+	c.P99 = newStatChange(float64(c.Before.P99), float64(c.After.P99))
+	c.U, c.Z, c.PValue = MannWhitneyU(before, after)
+	if c.PValue < alpha {
+		c.Regression = c.Z > 0
+		c.Improvement = c.Z < 0
+	}
+	return c
+}
+
+/** Returns the U statistic of b against a, its z-score under the normal
+    approximation (with tie and continuity corrections), and the two-sided
+    p-value. The approximation is rough for fewer than about 8 deltas a side. */
+func MannWhitneyU(a []int64, b []int64) (u float64, z float64, p float64) {
+	var n1, n2 float64 = float64(len(a)), float64(len(b))
+	if len(a) == 0 || len(b) == 0 {
+		return 0, 0, 1
+	}
+	type sample struct {
+		value int64
+		fromB bool
+	}
+	var all []sample = make([]sample, 0, len(a) + len(b))
+	for _, v := range a {
+		all = append(all, sample{v, false})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, true})
+	}
+	sort.Slice(all, func (i int, j int) bool { return all[i].value < all[j].value })
+
+	// Tied values share the average of their ranks.
+	var rankSumB float64 = 0
+	var tieTerm float64 = 0
+	for i := 0; i < len(all); {
+		var j int = i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		var rank float64 = float64(i + j + 1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromB {
+				rankSumB += rank
+			}
+		}
+		var t float64 = float64(j - i)
+		tieTerm += t * t * t - t
+		i = j
+	}
+	u = rankSumB - n2 * (n2 + 1) / 2
+
+	var n float64 = n1 + n2
+	var mean float64 = n1 * n2 / 2
+	var variance float64 = n1 * n2 / 12 * ((n + 1) - tieTerm / (n * (n - 1)))
+	if variance <= 0 {
+		return u, 0, 1
+	}
+	var diff float64 = u - mean
+	if diff > 0.5 {
+		diff -= 0.5
+	} else if diff < -0.5 {
+		diff += 0.5
+	} else {
+		diff = 0
+	}
+	z = diff / math.Sqrt(variance)
+	p = math.Erfc(math.Abs(z) / math.Sqrt2)
+	return u, z, p
+}
@@ -0,0 +1,59 @@
+package timers
+
+import "math"
+import "testing"
+
+func TestCompare1(t *testing.T) {
+	// Four values are tied across the samples, so the variance is
+	// 64/12 * (17 - 24/240) = 90.13 and z = (56 - 32 - 0.5) / 9.494.
+	var a []int64 = []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	var b []int64 = []int64{5, 6, 7, 8, 9, 10, 11, 12}
+	u, z, p := MannWhitneyU(a, b)
+	if u != 56 || z <= 0 || math.Abs(z - 2.4753) > 0.0001 || math.Abs(p - 0.0133) > 0.0001 {
+		t.Logf("Bad test result u=%v z=%v p=%v", u, z, p)
+		t.Fail()
+	}
+	u, z, p = MannWhitneyU(a, a)
+	if u != 32 || z != 0 || p != 1 {
+		t.Logf("Identical samples gave u=%v z=%v p=%v", u, z, p)
+		t.Fail()
+	}
+	if _, _, p = MannWhitneyU([]int64{3, 3}, []int64{3, 3}); p != 1 {
+		t.Log("All ties should give p=1")
+		t.Fail()
+	}
+}
+
+func TestCompare2(t *testing.T) {
+	var before map[string][]int64 = map[string][]int64{
+		"slower": []int64{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
+		"faster": []int64{20, 21, 22, 23, 24, 25, 26, 27, 28, 29},
+		"same": []int64{5, 6, 7, 8, 9, 5, 6, 7, 8, 9},
+		"gone": []int64{1},
+	}
+	var after map[string][]int64 = map[string][]int64{
+		"slower": []int64{20, 21, 22, 23, 24, 25, 26, 27, 28, 29},
+		"faster": []int64{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
+		"same": []int64{6, 5, 8, 7, 9, 6, 5, 8, 7, 9},
+		"new": []int64{1},
+	}
+	var comparisons []TimerComparison = CompareDeltas(before, after, DEFAULT_ALPHA)
+	if len(comparisons) != 5 || comparisons[0].Name != "faster" || comparisons[4].Name != "slower" {
+		t.Logf("Bad comparisons %v", comparisons)
+		t.Fail()
+		return
+	}
+	var faster, gone, same, slower TimerComparison = comparisons[0], comparisons[1], comparisons[3], comparisons[4]
+	if !slower.Regression || slower.Improvement || slower.Mean.Absolute != 10 || slower.Mean.Relative != 10 / 14.5 {
+		t.Logf("Bad regression %+v", slower)
+		t.Fail()
+	}
+	if !faster.Improvement || faster.Regression || faster.P50.Absolute != -10 {
+		t.Logf("Bad improvement %+v", faster)
+		t.Fail()
+	}
+	if same.Regression || same.Improvement || gone.PValue != 1 || gone.After.Count != 0 || gone.Mean.Relative != -1 {
+		t.Log("Unchanged timers were flagged")
+		t.Fail()
+	}
+}
@@ -0,0 +1,94 @@
+package timers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	)
+
+/* CONTEXT-SCOPED TIMERS
+   A timer scope attached to a context keeps its own set of named timers. When
+   the context is cancelled, every timer still running in the scope is ended
+   with OUTCOME_CANCELLED. */
+
+type timerScopeKey struct{}
+
+type timerScope struct {
+	start func(string) *Handle
+	lock sync.Mutex
+	running map[string]*Handle
+	done bool // set once the context's cancellation has been processed
+}
+
+/** start chooses the backend, e.g. StartLogHandle or StartBufferedLogHandle. */
+func WithTimerScope(ctx context.Context, start func(string) *Handle) context.Context {
+	var scope *timerScope = &timerScope{start: start, running: make(map[string]*Handle)}
+	ctx = context.WithValue(ctx, timerScopeKey{}, scope)
+	context.AfterFunc(ctx, scope.cancel)
+	return ctx
+}
+
+func getScope(ctx context.Context) *timerScope {
+	scope, ok := ctx.Value(timerScopeKey{}).(*timerScope)
+	if !ok {
+		panic("Attempted to use context timers on a context without a timer scope")
+	}
+	return scope
+}
+
+func (scope *timerScope) cancel() {
+	scope.lock.Lock()
+	defer scope.lock.Unlock()
+	scope.done = true
+	for _, h := range scope.running {
+		h.finish(OUTCOME_CANCELLED)
+	}
+}
+
+/** Timer names are unique within a scope, as with the hashtable timers. If the
+    context has already been cancelled, the timer is ended as soon as it starts. */
+func StartContextTimer(ctx context.Context, name string) *Handle {
+	var scope *timerScope = getScope(ctx)
+	scope.lock.Lock()
+	defer scope.lock.Unlock()
+	if h, ok := scope.running[name]; ok && h.Delta() == -2 {
+		panic(fmt.Sprintf("Attempted to start running timer %s", name))
+	}
+	var h *Handle = scope.start(name)
+	scope.running[name] = h
+	if scope.done || ctx.Err() != nil {
+		h.finish(OUTCOME_CANCELLED)
+	}
+	return h
+}
+
+/** If the timer was already ended by cancellation, this returns the delta up to
+    the cancellation without recording anything further. A timer ended after the
+    context is done counts as cancelled even if the scope hasn't caught up yet. */
+func EndContextTimer(ctx context.Context, name string) int64 {
+	var scope *timerScope = getScope(ctx)
+	scope.lock.Lock()
+	h, ok := scope.running[name]
+	delete(scope.running, name)
+	scope.lock.Unlock()
+	if !ok {
+		panic(fmt.Sprintf("Attempted to end timer %s, which is not running", name))
+	}
+	var outcome Outcome = OUTCOME_NONE
+	if ctx.Err() != nil {
+		outcome = OUTCOME_CANCELLED
+	}
+	delta, _ := h.finish(outcome)
+	return delta
+}
+
+func PollContextTimer(ctx context.Context, name string) int64 {
+	var scope *timerScope = getScope(ctx)
+	scope.lock.Lock()
+	h, ok := scope.running[name]
+	scope.lock.Unlock()
+	if !ok {
+		panic(fmt.Sprintf("Attempted to poll timer %s, which is not running", name))
+	}
+	return h.Poll()
+}
@@ -0,0 +1,65 @@
+package timers
+
+import "context"
+import "os"
+import "testing"
+
+func TestContextTimers1(t *testing.T) {
+	defer ResetLogBuffer()
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = WithTimerScope(ctx, StartBufferedLogHandle)
+	StartContextTimer(ctx, "handler")
+	var db *Handle = StartContextTimer(ctx, "db")
+	if PollContextTimer(ctx, "db") < 0 {
+		t.Fail()
+	}
+	EndContextTimer(ctx, "db")
+	cancel()
+	if EndContextTimer(ctx, "handler") < 0 {
+		t.Log("Cancelled timer has no delta")
+		t.Fail()
+	}
+	if db.Outcome() != OUTCOME_NONE {
+		t.Log("Timer ended before cancellation was marked cancelled")
+		t.Fail()
+	}
+	var late *Handle = StartContextTimer(ctx, "late")
+	if late.Outcome() != OUTCOME_CANCELLED {
+		t.Log("Timer started after cancellation is still running")
+		t.Fail()
+	}
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/contextbuffer")
+	WriteLogBuffer(f)
+	f.Close()
+	var tmap map[string]*TimerSummary = ParseFileToMap([]string{"/home/sam/timers/contextbuffer"})
+	for _, name := range []string{"handler", "late"} {
+		for _, inst := range tmap[name].instances {
+			if inst.outcome != OUTCOME_CANCELLED {
+				t.Logf("Timer %s has outcome %v after parsing", name, inst.outcome)
+				t.Fail()
+			}
+		}
+	}
+	for _, inst := range tmap["db"].instances {
+		if inst.outcome != OUTCOME_NONE {
+			t.Fail()
+		}
+	}
+}
+
+func TestContextTimers2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+		}()
+	var ctx context.Context = WithTimerScope(context.Background(), Start)
+	StartContextTimer(ctx, "t1")
+	EndContextTimer(ctx, "t1")
+	StartContextTimer(ctx, "t1")
+	finished = true
+	StartContextTimer(ctx, "t1")
+}
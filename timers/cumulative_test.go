@@ -0,0 +1,61 @@
+package timers
+
+import "testing"
+
+func TestCumulativeTimers1(t *testing.T) {
+	var total int64 = 0
+	var last int64
+	for i := 0; i < 3; i++ {
+		StartCumulativeTimer("t1")
+		expFibonacci(20)
+		last = EndCumulativeTimer("t1")
+		total += last
+	}
+	StartCumulativeTimer("t1")
+	var c CumulativeTimer = GetCumulativeTimer("t1")
+	if c.Count != 3 || c.Total != total || c.Last != last || c.Mean() != total / 3 {
+		t.Logf("Bad totals %+v", c)
+		t.Fail()
+	}
+	if GetTimerDelta("t1") != -2 {
+		t.Log("New run kept the previous end")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	StartCumulativeTimer("t1")
+	if GetCumulativeTimer("t1").Count != 0 {
+		t.Log("Totals survived DeleteTimer")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+}
+
+func TestCumulativeTimers2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteTimer("t1")
+		}()
+	StartCumulativeTimer("t1")
+	EndCumulativeTimer("t1")
+	StartCumulativeTimer("t1")
+	finished = true
+	StartCumulativeTimer("t1")
+}
+
+func TestCumulativeTimers3(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteTimer("t1")
+		}()
+	StartTimer("t1")
+	finished = true
+	EndCumulativeTimer("t1")
+}
@@ -0,0 +1,211 @@
+package timers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	)
+
+/* HTTP DEBUG PAGE
+   A page, like the ones net/http/pprof serves, showing what the timers of a
+   live process are doing: the hashtable timers still running, a summary of the
+   buffered log, and the current file timer collection. Mount it under a prefix
+   ending in a slash, e.g.
+       http.Handle("/debug/timers/", timers.DebugHandler())
+   and the buffered log can be downloaded from /debug/timers/log. */
+
+const DEBUG_LOG_CONTENT_TYPE string = "application/octet-stream"
+
+type debugTimer struct {
+	Name string `json:"name"`
+	State string `json:"state"`
+	Start int64 `json:"start"`
+	Elapsed int64 `json:"elapsed"` // ns, -1 if unknown
+}
+
+type debugBufferedTimer struct {
+	debugTimer
+	Count int `json:"count"` // completed intervals
+	Mean int64 `json:"mean"`
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+type debugFileTimers struct {
+	Collection string `json:"collection"`
+	Namespace string `json:"namespace"`
+	Timers []debugTimer `json:"timers"`
+	Namespaces []string `json:"namespaces"`
+	Error string `json:"error,omitempty"` // if the collection couldn't be read
+}
+
+type debugSnapshot struct {
+	Time int64 `json:"time"`
+	Host string `json:"host"`
+	Hashtable []debugTimer `json:"hashtable"`
+	Buffered []debugBufferedTimer `json:"buffered"`
+	Files *debugFileTimers `json:"files,omitempty"` // nil without a collection
+}
+
+func newDebugTimer(info TimerInfo) debugTimer {
+	return debugTimer{info.Name, info.State, info.Start, info.Elapsed}
+}
+
+/** Only hashtable timers that are running or paused are included; their
+    elapsed time is the active time PollTimer would return. */
+func takeDebugSnapshot() debugSnapshot {
+	var snapshot debugSnapshot = debugSnapshot{Time: time.Now().UnixNano(), Host: hostname}
+	snapshot.Hashtable = make([]debugTimer, 0)
+	for _, info := range ListTimers() {
+		if info.State == STATE_RUNNING || info.State == STATE_PAUSED {
+			snapshot.Hashtable = append(snapshot.Hashtable, newDebugTimer(info))
+		}
+	}
+	snapshot.Buffered = bufferedDebugTimers()
+	if timerDir != "" {
+		snapshot.Files = fileDebugTimers()
+	}
+	return snapshot
+}
+
+func bufferedDebugTimers() []debugBufferedTimer {
+	var deltamap map[string][]int64 = make(map[string][]int64)
+	bufferLock.Lock()
+	for name, summary := range bufferedTimers {
+		var deltas []int64 = make([]int64, 0)
+		settledDeltas(summary, func (labels Labels, delta int64) {
+			deltas = append(deltas, delta)
+		})
+		deltamap[name] = deltas
+	}
+	bufferLock.Unlock()
+	var buffered []debugBufferedTimer = make([]debugBufferedTimer, 0, len(deltamap))
+	for _, info := range ListBufferedLogTimers() {
+		var stats DeltaStats = SummarizeDeltas(deltamap[info.Name])
+		buffered = append(buffered, debugBufferedTimer{newDebugTimer(info), stats.Count, int64(stats.Mean),
+			stats.P50, stats.P90, stats.P99, stats.Max})
+	}
+	return buffered
+}
+
+/** A collection that can't be listed, e.g. because its directory was removed,
+    is reported rather than failing the whole page. */
+func fileDebugTimers() (files *debugFileTimers) {
+	files = &debugFileTimers{Collection: timerRoot, Namespace: timerNamespace,
+		Timers: make([]debugTimer, 0), Namespaces: make([]string, 0)}
+	defer func () {
+		if r := recover(); r != nil {
+			files.Error = fmt.Sprint(r)
+		}
+	}()
+	for _, info := range ListFileTimers() {
+		files.Timers = append(files.Timers, newDebugTimer(info))
+	}
+	files.Namespaces = ListFileTimerNamespaces()
+	return files
+}
+
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+/** Serves the page as HTML, or as JSON when asked for with ?format=json or an
+    Accept header of application/json. A path ending in /log downloads the
+    buffered log, as written by WriteLogBuffer, which is streamed to the client
+    rather than copied into memory first. */
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/log") {
+			serveDebugLog(w)
+		} else if wantsJSON(r) {
+			var buf bytes.Buffer
+			var encoder *json.Encoder = json.NewEncoder(&buf)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(takeDebugSnapshot()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(buf.Bytes())
+		} else {
+			var buf bytes.Buffer
+			if err := debugTemplate.Execute(&buf, takeDebugSnapshot()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(buf.Bytes())
+		}
+	})
+}
+
+/** WriteLogBuffer only holds the buffered log timers up while it copies them,
+    not while a slow client downloads. The only errors it can return come from
+    writing to the client, after the headers have gone, so there is nothing left
+    to report them to. */
+func serveDebugLog(w http.ResponseWriter) {
+	var fname string = fmt.Sprintf("timers-%s-%d.log", sanitizePromName(hostname), time.Now().Unix())
+	w.Header().Set("Content-Type", DEBUG_LOG_CONTENT_TYPE)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname))
+	WriteLogBuffer(w)
+}
+
+func debugDuration(ns int64) string {
+	if ns < 0 {
+		return "-"
+	}
+	return time.Duration(ns).String()
+}
+
+func debugTime(ns int64) string {
+	if ns == 0 {
+		return "-"
+	}
+	return time.Unix(0, ns).Format("2006-01-02 15:04:05.000")
+}
+
+var debugTemplate *template.Template = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"duration": debugDuration,
+	"time": debugTime,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Timers on {{.Host}}</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 0 1em 0 0; text-align: left; }
+td.num { text-align: right; }
+</style>
+</head>
+<body>
+<p>Timers on {{.Host}} at {{time .Time}} &middot; <a href="?format=json">JSON</a> &middot; <a href="log">download buffered log</a></p>
+<h2>Hashtable timers ({{len .Hashtable}} running)</h2>
+<table>
+<tr><th>name</th><th>state</th><th>started</th><th>elapsed</th></tr>
+{{range .Hashtable}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td>{{time .Start}}</td><td class="num">{{duration .Elapsed}}</td></tr>
+{{end}}</table>
+<h2>Buffered log timers ({{len .Buffered}})</h2>
+<table>
+<tr><th>name</th><th>state</th><th>elapsed</th><th>count</th><th>mean</th><th>p50</th><th>p90</th><th>p99</th><th>max</th></tr>
+{{range .Buffered}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td class="num">{{duration .Elapsed}}</td><td class="num">{{.Count}}</td><td class="num">{{duration .Mean}}</td><td class="num">{{duration .P50}}</td><td class="num">{{duration .P90}}</td><td class="num">{{duration .P99}}</td><td class="num">{{duration .Max}}</td></tr>
+{{end}}</table>
+{{with .Files}}<h2>File timers in {{.Collection}}{{if .Namespace}}, namespace {{.Namespace}}{{end}} ({{len .Timers}})</h2>
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<table>
+<tr><th>name</th><th>state</th><th>started</th><th>elapsed</th></tr>
+{{range .Timers}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td>{{time .Start}}</td><td class="num">{{duration .Elapsed}}</td></tr>
+{{end}}</table>
+{{if .Namespaces}}<p>Namespaces: {{range $i, $ns := .Namespaces}}{{if $i}}, {{end}}{{$ns}}{{end}}</p>
+{{end}}{{end}}</body>
+</html>
+`))
@@ -0,0 +1,121 @@
+package timers
+
+import "bytes"
+import "encoding/json"
+import "net/http"
+import "net/http/httptest"
+import "strings"
+import "testing"
+
+func TestDebugHTTP1(t *testing.T) {
+	defer ResetLogBuffer()
+	defer DeleteTimer("debugended")
+	defer DeleteTimer("debugrunning")
+	StartTimer("debugrunning")
+	StartTimer("debugended")
+	EndTimer("debugended")
+	StartBufferedLogTimer("debuglog")
+	EndBufferedLogTimer("debuglog")
+	StartBufferedLogHandle("debuglog")
+	StartBufferedLogTimer("debugoverlap")
+	StartBufferedLogTimer("debugoverlap")
+	EndBufferedLogTimer("debugoverlap")
+	EndBufferedLogTimer("debugoverlap")
+	SetFileTimerCollection("/home/sam/timers")
+	StartFileTimer("debugfile")
+	defer DeleteFileTimerIfExists("debugfile")
+
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	DebugHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/timers/?format=json", nil))
+	var snapshot debugSnapshot
+	if err := json.Unmarshal(recorder.Body.Bytes(), &snapshot); err != nil {
+		t.Logf("Bad JSON %v: %s", err, recorder.Body.String())
+		t.Fail()
+		return
+	}
+	if len(snapshot.Hashtable) != 1 || snapshot.Hashtable[0].Name != "debugrunning" || snapshot.Hashtable[0].Elapsed <= 0 {
+		t.Logf("Bad hashtable timers %v", snapshot.Hashtable)
+		t.Fail()
+	}
+	if len(snapshot.Buffered) != 2 || snapshot.Buffered[0].State != STATE_RUNNING || snapshot.Buffered[0].Count != 1 ||
+		snapshot.Buffered[1].Name != "debugoverlap" || snapshot.Buffered[1].Count != 0 {
+		t.Logf("Bad buffered timers %v", snapshot.Buffered)
+		t.Fail()
+	}
+	if snapshot.Files == nil || snapshot.Files.Collection != "/home/sam/timers" || snapshot.Files.Error != "" {
+		t.Logf("Bad file timers %v", snapshot.Files)
+		t.Fail()
+	} else {
+		var found bool = false
+		for _, timer := range snapshot.Files.Timers {
+			found = found || timer.Name == "debugfile" && timer.State == STATE_RUNNING
+		}
+		if !found {
+			t.Logf("Missing running file timer in %v", snapshot.Files.Timers)
+			t.Fail()
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	var request *http.Request = httptest.NewRequest("GET", "/debug/timers/", nil)
+	request.Header.Set("Accept", "application/json")
+	DebugHandler().ServeHTTP(recorder, request)
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Log("Accept header was ignored")
+		t.Fail()
+	}
+}
+
+func TestDebugHTTP2(t *testing.T) {
+	defer ResetLogBuffer()
+	StartBufferedLogTimer("<debug>")
+	EndBufferedLogTimer("<debug>")
+
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	DebugHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/timers/", nil))
+	var body string = recorder.Body.String()
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, "&lt;debug&gt;") ||
+		strings.Contains(body, "<debug>") || !strings.Contains(body, "href=\"log\"") {
+		t.Logf("Bad page %s", body)
+		t.Fail()
+	}
+
+	recorder = httptest.NewRecorder()
+	DebugHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/timers/log", nil))
+	var expected bytes.Buffer
+	WriteLogBuffer(&expected)
+	if recorder.Header().Get("Content-Type") != DEBUG_LOG_CONTENT_TYPE ||
+		!strings.HasPrefix(recorder.Header().Get("Content-Disposition"), "attachment; filename=") {
+		t.Logf("Bad download headers %v", recorder.Header())
+		t.Fail()
+	}
+	var header int = len(headerRecord().encode())
+	if recorder.Body.Len() != expected.Len() || !bytes.Equal(recorder.Body.Bytes()[header:], expected.Bytes()[header:]) {
+		t.Log("Downloaded log differs from WriteLogBuffer")
+		t.Fail()
+	}
+}
+
+/** Starts a buffered log timer on each write, which would deadlock if the
+    download held up the buffered log timers. */
+type busyRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (recorder busyRecorder) Write(data []byte) (int, error) {
+	StartBufferedLogTimer("debugbusy")
+	return recorder.ResponseRecorder.Write(data)
+}
+
+func TestDebugHTTP3(t *testing.T) {
+	defer ResetLogBuffer()
+	StartBufferedLogTimer("debuglog")
+	EndBufferedLogTimer("debuglog")
+	var recorder busyRecorder = busyRecorder{httptest.NewRecorder()}
+	DebugHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/timers/log", nil))
+	var header int = len(headerRecord().encode())
+	if recorder.Body.Len() != header + 2 * len((&logRecord{name: "debuglog", symbol: START_SYMBOL}).encode()) {
+		t.Logf("Download of %d bytes included timers started during it", recorder.Body.Len())
+		t.Fail()
+	}
+}
@@ -0,0 +1,86 @@
+package timers
+
+import (
+	"fmt"
+	"io"
+	)
+
+/* FILE TIMER EXPORT
+   Converts a file-timer collection into the same summaries the log timers
+   parse into, so that ParseMapToDeltas and friends work on both. Each run of a
+   file timer becomes one instance. */
+
+/** Scans the current namespace and every namespace nested in it. Timers in a
+    nested namespace carry a "namespace" label with its path relative to the
+    current one. Corrupt timers are skipped and reported as anomalies, once the
+    collection is unlocked. */
+func ParseFileTimersToMap() map[string]*TimerSummary {
+	var tmap map[string]*TimerSummary = make(map[string]*TimerSummary)
+	var anomalies []Anomaly
+	func () {
+		defer lockFileCollection()()
+		parseFileTimerDir(tmap, timerDir, "", func (a Anomaly) { anomalies = append(anomalies, a) })
+	}()
+	for _, a := range anomalies {
+		reportAnomaly(a)
+	}
+	return tmap
+}
+
+func parseFileTimerDir(tmap map[string]*TimerSummary, dir string, namespace string, report func(Anomaly)) {
+	names, namespaces, err := scanFileTimerDir(dir)
+	if err != nil {
+		panic(fmt.Sprintf("Could not list file timers in %s: %v", dir, err))
+	}
+	for _, name := range names {
+		record, err := loadFileTimerIn(dir, name)
+		if err == ErrFileTimerMissing {
+			continue
+		} else if err != nil {
+			report(Anomaly{name, 0, fmt.Sprintf("could not be read: %v", err)})
+			continue
+		}
+		summary, ok := tmap[name]
+		if !ok {
+			summary = newTimerSummary(0)
+			tmap[name] = summary
+		}
+		for _, run := range record.Runs {
+			addFileTimerRun(summary, run, namespace)
+		}
+	}
+	for _, ns := range namespaces {
+		var nested string = ns
+		if namespace != "" {
+			nested = namespace + "/" + ns
+		}
+		parseFileTimerDir(tmap, dir + "/" + encodeTimerName(ns), nested, report)
+	}
+}
+
+func addFileTimerRun(summary *TimerSummary, run FileTimerRun, namespace string) {
+	if run.Start == 0 && run.End == 0 {
+		return
+	}
+	var inst *timerInstance = summary.getInstance(nextInstanceID())
+	inst.start, inst.started = run.Start, run.Start != 0
+	inst.end, inst.ended = run.End, run.End != 0
+	inst.outcome = run.Outcome
+	inst.pid, inst.host = run.StartPID, run.StartHost
+	inst.labels = run.Labels.copy()
+	if namespace != "" {
+		inst.labels["namespace"] = namespace
+	}
+}
+
+/** Writes the collection as a log that ParseFileToMap can read back. */
+func WriteFileTimerLog(writer io.Writer) error {
+	var err error
+	for name, summary := range ParseFileTimersToMap() {
+		err = writeInstances(writer, summary.instances, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package timers
+
+import "bytes"
+import "io/ioutil"
+import "os"
+import "testing"
+
+func TestFileExport1(t *testing.T) {
+	defer SetFileTimerCollection("/home/sam/timers")
+	os.RemoveAll("/home/sam/timers/export")
+	os.MkdirAll("/home/sam/timers/export", 0755)
+	SetFileTimerCollection("/home/sam/timers/export")
+	StartFileTimer("build")
+	EndFileTimer("build")
+	StartFileTimer("build")
+	LabelFileTimer("build", Labels{"target": "linux"})
+	EndFileTimer("build")
+	StartFileTimer("deploy")
+	SetFileTimerNamespace("nightly")
+	StartFileTimer("build")
+	EndFileTimer("build")
+	SetFileTimerNamespace("")
+	ioutil.WriteFile("/home/sam/timers/export/broken.timer", []byte("{\"format\": \"go-timers/file-ti"), 0644)
+	defer SetAnomalyReporter(printAnomaly)
+	var reported []Anomaly
+	SetAnomalyReporter(func (a Anomaly) { reported = append(reported, a) })
+	var tmap map[string]*TimerSummary = ParseFileTimersToMap()
+	if len(reported) != 1 || reported[0].Name != "broken" || tmap["broken"] != nil {
+		t.Logf("Corrupt timer not reported: %v", reported)
+		t.Fail()
+	}
+	if len(tmap["build"].instances) != 3 || len(tmap["deploy"].instances) != 1 {
+		t.Logf("Bad summaries %v", tmap)
+		t.Fail()
+		return
+	}
+	var grouped map[string][]int64 = ParseMapToDeltasByLabels(tmap, "namespace", "target")
+	if len(grouped["build{namespace=nightly,target=}"]) != 1 || len(grouped["build{namespace=,target=linux}"]) != 1 {
+		t.Logf("Bad grouped deltas %v", grouped)
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	if err := WriteFileTimerLog(&buf); err != nil {
+		t.Logf("Export failed: %v", err)
+		t.Fail()
+	}
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/exportlog")
+	f.Write(buf.Bytes())
+	f.Close()
+	var deltas map[string][]int64 = ParseMapToDeltas(ParseFileToMap([]string{"/home/sam/timers/exportlog"}))
+	if len(deltas["build"]) != 3 || len(deltas["deploy"]) != 0 {
+		t.Logf("Bad deltas %v", deltas)
+		t.Fail()
+	}
+	os.RemoveAll("/home/sam/timers/export")
+}
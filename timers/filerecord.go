@@ -0,0 +1,165 @@
+package timers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	)
+
+/* FILE TIMER RECORDS
+   Each file timer is a single JSON file holding every run of the timer along
+   with who started and ended it. Timers in the legacy format, a name_start and
+   name_end file holding a raw time each, are still read, and are converted the
+   next time they are written. */
+
+const (
+	FILE_TIMER_FORMAT string = "go-timers/file-timer"
+	FILE_TIMER_VERSION int = 1
+	FILE_TIMER_SUFFIX string = ".timer"
+	)
+
+type FileTimerRun struct {
+	Start int64 `json:"start,omitempty"` // 0 if the run was ended without being started
+	End int64 `json:"end,omitempty"` // 0 while the run is in progress
+	Outcome Outcome `json:"outcome,omitempty"`
+	Labels Labels `json:"labels,omitempty"`
+	StartPID int `json:"start_pid,omitempty"`
+	StartHost string `json:"start_host,omitempty"`
+	EndPID int `json:"end_pid,omitempty"`
+	EndHost string `json:"end_host,omitempty"`
+}
+
+type fileTimerRecord struct {
+	Format string `json:"format"`
+	Version int `json:"version"`
+	Name string `json:"name"`
+	Runs []FileTimerRun `json:"runs"`
+}
+
+/** The most runs a record keeps by default; see SetFileTimerMaxRuns. */
+const DEFAULT_FILE_TIMER_MAX_RUNS int = 1000
+
+var fileTimerMaxRuns int = DEFAULT_FILE_TIMER_MAX_RUNS
+
+/** Since the whole record is rewritten on every start and end, a timer that is
+    run forever would otherwise get slower to write without bound. When a record
+    has more runs than this, the oldest are dropped as it is written. 0 keeps
+    every run. */
+func SetFileTimerMaxRuns(max int) {
+	if max < 0 {
+		panic(fmt.Sprintf("Attempted to keep %d file timer runs", max))
+	}
+	fileTimerMaxRuns = max
+}
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+}
+
+func (record *fileTimerRecord) lastRun() *FileTimerRun {
+	if len(record.Runs) == 0 {
+		return nil
+	}
+	return &record.Runs[len(record.Runs) - 1]
+}
+
+func (record *fileTimerRecord) newRun() *FileTimerRun {
+	record.Runs = append(record.Runs, FileTimerRun{})
+	return record.lastRun()
+}
+
+/** Returns ErrFileTimerMissing if the timer doesn't exist in either format. */
+func loadFileTimer(name string) (*fileTimerRecord, error) {
+	return loadFileTimerIn(timerDir, name)
+}
+
+func loadFileTimerIn(dir string, name string) (*fileTimerRecord, error) {
+	data, err := ioutil.ReadFile(timerPath(dir, name, FILE_TIMER_SUFFIX))
+	if os.IsNotExist(err) {
+		return loadLegacyFileTimer(dir, name)
+	} else if err != nil {
+		return nil, err
+	}
+	var record *fileTimerRecord = &fileTimerRecord{}
+	if json.Unmarshal(data, record) != nil || record.Format != FILE_TIMER_FORMAT {
+		return nil, ErrFileTimerCorrupt
+	} else if record.Version > FILE_TIMER_VERSION {
+		return nil, fmt.Errorf("file timer %s has unsupported version %d", name, record.Version)
+	}
+	return record, nil
+}
+
+/** Like loadFileTimer, but a missing timer gives an empty record to fill in. */
+func loadFileTimerForUpdate(name string) *fileTimerRecord {
+	record, err := loadFileTimer(name)
+	if err == ErrFileTimerMissing {
+		return &fileTimerRecord{Name: name}
+	} else if err != nil {
+		panic(fmt.Sprintf("Could not read file timer %s: %v", name, err))
+	}
+	return record
+}
+
+/** Also removes the legacy files, if the timer was in that format. */
+func saveFileTimer(name string, record *fileTimerRecord) {
+	record.Format = FILE_TIMER_FORMAT
+	record.Version = FILE_TIMER_VERSION
+	record.Name = name
+	if fileTimerMaxRuns > 0 && len(record.Runs) > fileTimerMaxRuns {
+		record.Runs = append([]FileTimerRun(nil), record.Runs[len(record.Runs) - fileTimerMaxRuns:]...)
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = writeFileAtomic(expandFilePathRecord(name), append(data, '\n'))
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Could not write to file timer %s: %v", expandFilePathRecord(name), err))
+	}
+	removeLegacyFileTimer(name)
+}
+
+/** The legacy format holds at most one run and no metadata beyond an optional
+    outcome byte after the end time and a separate labels file. */
+func loadLegacyFileTimer(dir string, name string) (*fileTimerRecord, error) {
+	var run FileTimerRun
+	var found bool = false
+	var data []byte
+	var err error
+	for _, path := range []string{timerPath(dir, name, "_start"), timerPath(dir, name, "_end")} {
+		data, err = ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if len(data) < 8 {
+			return nil, ErrFileTimerCorrupt
+		}
+		found = true
+		if path == timerPath(dir, name, "_start") {
+			run.Start = int64(binary.LittleEndian.Uint64(data))
+		} else {
+			run.End = int64(binary.LittleEndian.Uint64(data))
+			if len(data) > 8 {
+				run.Outcome = Outcome(data[8])
+			}
+		}
+	}
+	data, err = ioutil.ReadFile(timerPath(dir, name, "_labels"))
+	if err == nil {
+		found = true
+		run.Labels, err = readLabels(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return nil, ErrFileTimerCorrupt
+		}
+	}
+	if !found {
+		return nil, ErrFileTimerMissing
+	}
+	return &fileTimerRecord{FILE_TIMER_FORMAT, FILE_TIMER_VERSION, name, []FileTimerRun{run}}, nil
+}
@@ -0,0 +1,82 @@
+package timers
+
+import "encoding/binary"
+import "io/ioutil"
+import "os"
+import "testing"
+
+func TestFileTimerRecords1(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	StartFileTimer("t1")
+	LabelFileTimer("t1", Labels{"run": "1"})
+	EndFileTimer("t1")
+	TimeFile("t1", func () error { return nil })
+	StartFileTimer("t1")
+	StartFileTimer("t1") // overwrites the running start rather than adding a run
+	runs, err := GetFileTimerHistory("t1")
+	DeleteFileTimer("t1")
+	if err != nil || len(runs) != 3 {
+		t.Logf("Bad history %v: %v", runs, err)
+		t.Fail()
+		return
+	}
+	if runs[0].Labels["run"] != "1" || runs[1].Labels != nil || runs[1].Outcome != OUTCOME_SUCCESS || runs[2].End != 0 {
+		t.Logf("Bad runs %+v", runs)
+		t.Fail()
+	}
+	if runs[0].StartPID != os.Getpid() || runs[0].EndPID != os.Getpid() || runs[0].StartHost != hostname {
+		t.Logf("Bad metadata %+v", runs[0])
+		t.Fail()
+	}
+}
+
+func TestFileTimerRecords2(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	var buf []byte = make([]byte, 9)
+	binary.LittleEndian.PutUint64(buf, 1000)
+	ioutil.WriteFile("/home/sam/timers/legacy_start", buf[:8], 0644)
+	binary.LittleEndian.PutUint64(buf, 1500)
+	buf[8] = byte(OUTCOME_ERROR)
+	ioutil.WriteFile("/home/sam/timers/legacy_end", buf, 0644)
+	if GetFileTimerDelta("legacy") != 500 || GetFileTimerOutcome("legacy") != OUTCOME_ERROR {
+		t.Log("Legacy timer read incorrectly")
+		t.Fail()
+	}
+	StartFileTimer("legacy")
+	runs, _ := GetFileTimerHistory("legacy")
+	if len(runs) != 2 || runs[0].Start != 1000 || runs[0].End != 1500 {
+		t.Logf("Legacy run lost in conversion: %+v", runs)
+		t.Fail()
+	}
+	if _, err := os.Stat("/home/sam/timers/legacy_start"); !os.IsNotExist(err) {
+		t.Log("Legacy files survived conversion")
+		t.Fail()
+	}
+	DeleteFileTimer("legacy")
+	ioutil.WriteFile("/home/sam/timers/future.timer", []byte(`{"format": "go-timers/file-timer", "version": 99, "runs": []}`), 0644)
+	if _, err := GetFileTimerHistory("future"); err == nil || err == ErrFileTimerCorrupt {
+		t.Logf("Future version gave %v", err)
+		t.Fail()
+	}
+	DeleteFileTimer("future")
+}
+
+func TestFileTimerRecords3(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	defer SetFileTimerMaxRuns(DEFAULT_FILE_TIMER_MAX_RUNS)
+	SetFileTimerMaxRuns(3)
+	var starts []int64
+	for i := 0; i < 5; i++ {
+		StartFileTimer("retained")
+		var start int64
+		start, _ = GetFileTimerStart("retained")
+		starts = append(starts, start)
+		EndFileTimer("retained")
+	}
+	runs, err := GetFileTimerHistory("retained")
+	if err != nil || len(runs) != 3 || runs[0].Start != starts[2] || runs[2].Start != starts[4] {
+		t.Logf("Bad retained runs %v", runs)
+		t.Fail()
+	}
+	DeleteFileTimer("retained")
+}
@@ -0,0 +1,121 @@
+package timers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	)
+
+/* HANDLE-BASED TIMERS
+   Every Start returns a fresh handle with its own instance ID, so any number of
+   instances of the same timer may run at once (e.g. one per request). */
+
+var instanceCounter uint64
+
+/** The high bits are random so that instance IDs from different processes
+    don't collide when their logs are parsed together. */
+func init() {
+	var seed []byte = make([]byte, 4)
+	rand.Read(seed)
+	instanceCounter = uint64(binary.LittleEndian.Uint32(seed)) << 32
+}
+
+func nextInstanceID() uint64 {
+	return atomic.AddUint64(&instanceCounter, 1)
+}
+
+type Handle struct {
+	name string
+	id uint64
+	start int64
+	record func(*logRecord) // nil if the handle is only kept in memory
+	lock sync.Mutex // guards the fields below, since a timer scope may end the handle from another goroutine
+	end int64
+	ended bool
+	outcome Outcome
+	labels Labels
+	laps []Lap
+}
+
+func startHandle(name string, record func(*logRecord)) *Handle {
+	var h *Handle = &Handle{name: name, id: nextInstanceID(), record: record}
+	h.start = time.Now().UnixNano()
+	if record != nil {
+		record(&logRecord{name: name, symbol: START_INSTANCE_SYMBOL, time: h.start, id: h.id})
+	}
+	return h
+}
+
+/** An in-memory timer, like the hashtable timers but without a global name. */
+func Start(name string) *Handle {
+	return startHandle(name, nil)
+}
+
+/** Name can't contain \0. */
+func StartLogHandle(name string) *Handle {
+	return startHandle(name, writeRecord)
+}
+
+func StartBufferedLogHandle(name string) *Handle {
+	return startHandle(name, bufferRecord)
+}
+
+/** Returns the time between Start and End. */
+func (h *Handle) End() int64 {
+	return h.EndWithOutcome(OUTCOME_NONE)
+}
+
+func (h *Handle) EndWithOutcome(outcome Outcome) int64 {
+	delta, ok := h.finish(outcome)
+	if !ok {
+		panic(fmt.Sprintf("Attempted to end stopped timer %s (instance %d)", h.name, h.id))
+	}
+	return delta
+}
+
+/** Ends the handle unless it has already been ended; ok reports which. */
+func (h *Handle) finish(outcome Outcome) (delta int64, ok bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.ended {
+		return h.end - h.start, false
+	}
+	h.end = time.Now().UnixNano()
+	h.ended = true
+	h.outcome = outcome
+	if h.record != nil {
+		h.record(endRecord(h.name, h.end, h.id, outcome))
+	}
+	return h.end - h.start, true
+}
+
+func (h *Handle) Poll() int64 {
+	return time.Now().UnixNano() - h.start
+}
+
+/** Returns -2 if the handle hasn't been ended, as GetTimerDelta does. */
+func (h *Handle) Delta() int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.ended {
+		return -2
+	}
+	return h.end - h.start
+}
+
+func (h *Handle) Outcome() Outcome {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.outcome
+}
+
+func (h *Handle) Name() string {
+	return h.name
+}
+
+func (h *Handle) ID() uint64 {
+	return h.id
+}
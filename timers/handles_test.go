@@ -0,0 +1,99 @@
+package timers
+
+import "os"
+import "testing"
+
+func TestHandleTimers1(t *testing.T) {
+	var done chan int64 = make(chan int64)
+	var ids chan uint64 = make(chan uint64, 3)
+	for i := 0; i < 3; i++ {
+		go func () {
+				var h *Handle = Start("request")
+				ids <- h.ID()
+				expFibonacci(25)
+				done <- h.End()
+			}()
+	}
+	for i := 0; i < 3; i++ {
+		if delta := <-done; delta < 0 {
+			t.Logf("Negative delta %v", delta)
+			t.Fail()
+		}
+	}
+	var a, b, c uint64 = <-ids, <-ids, <-ids
+	if a == b || b == c || a == c {
+		t.Log("Concurrent handles share an instance ID")
+		t.Fail()
+	}
+}
+
+func TestHandleTimers2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+		}()
+	var h *Handle = Start("t1")
+	if h.Delta() != -2 {
+		t.Fail()
+	}
+	h.End()
+	if h.Delta() < 0 {
+		t.Fail()
+	}
+	finished = true
+	h.End()
+}
+
+func TestHandleTimers3(t *testing.T) {
+	SetLogFile("/home/sam/timers/handlelog")
+	var h1 *Handle = StartLogHandle("request")
+	var h2 *Handle = StartLogHandle("request")
+	StartLogTimer("legacy")
+	StartLogHandle("request")
+	EndLogTimer("legacy")
+	h2.End()
+	h1.End()
+	StartLogHandle("dangling")
+	CloseLogFile()
+	var tmap map[string]*TimerSummary = ParseFileToMap([]string{"/home/sam/timers/handlelog"})
+	if len(tmap["request"].instances) != 3 || len(tmap["request"].starts) != 0 {
+		t.Log("Instances parsed incorrectly")
+		t.Fail()
+		return
+	}
+	var deltas map[string][]int64 = ParseMapToDeltas(tmap)
+	if len(deltas["request"]) != 2 || len(deltas["legacy"]) != 1 {
+		t.Logf("Bad deltas %v", deltas)
+		t.Fail()
+	}
+	if _, ok := deltas["dangling"]; ok {
+		t.Log("Unended instance produced a delta")
+		t.Fail()
+	}
+	if deltas["request"][0] < deltas["request"][1] {
+		t.Log("Deltas are not ordered by start time")
+		t.Fail()
+	}
+}
+
+func TestHandleTimers4(t *testing.T) {
+	defer ResetLogBuffer()
+	var h1 *Handle = StartBufferedLogHandle("request")
+	var h2 *Handle = StartBufferedLogHandle("request")
+	StartBufferedLogTimer("legacy")
+	h1.End()
+	EndBufferedLogTimer("legacy")
+	h2.End()
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/handlebuffer")
+	WriteLogBuffer(f)
+	f.Close()
+	var deltas map[string][]int64 = ParseMapToDeltas(ParseFileToMap([]string{"/home/sam/timers/handlebuffer"}))
+	if len(deltas["request"]) != 2 || len(deltas["legacy"]) != 1 {
+		t.Logf("Bad deltas %v", deltas)
+		t.Fail()
+	}
+}
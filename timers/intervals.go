@@ -0,0 +1,80 @@
+package timers
+
+import (
+	"sort"
+	)
+
+/* INTERVALS
+   A flat view of every completed timing in a set of summaries, for exporters
+   that need more than the deltas. */
+
+type Interval struct {
+	Name string
+	ID uint64 // 0 for starts and ends that had no instance ID
+	Start int64
+	End int64
+	Outcome Outcome
+	Labels Labels
+	Source string // the log file the interval was parsed from, if known
+	PID int // the process that started the timer, if recorded
+	Host string
+}
+
+func (interval Interval) Delta() int64 {
+	return interval.End - interval.Start
+}
+
+/** Pairs starts and ends as ParseMapToDeltas does, reporting the same
+    anomalies. The result is ordered by start time, then name. */
+func ParseMapToIntervals(tmap map[string]*TimerSummary) []Interval {
+	return parseMapToIntervals(tmap, reportAnomaly)
+}
+
+func parseMapToIntervals(tmap map[string]*TimerSummary, report func(Anomaly)) []Interval {
+	var intervals []Interval = make([]Interval, 0)
+	for tname, tsummary := range tmap {
+		var deltas []int64 = pairPositional(tname, tsummary, report)
+		for i := range deltas {
+			intervals = append(intervals, Interval{Name: tname, Start: tsummary.starts[i], End: tsummary.ends[i]})
+		}
+		for _, id := range pairInstances(tname, tsummary, report) {
+			var inst *timerInstance = tsummary.instances[id]
+			intervals = append(intervals, Interval{Name: tname, ID: id, Start: inst.start, End: inst.end,
+				Outcome: inst.outcome, Labels: inst.labels.copy(), Source: inst.source, PID: inst.pid, Host: inst.host})
+		}
+	}
+	sortIntervals(intervals)
+	return intervals
+}
+
+/** Parses each file on its own, so every interval can name the file it came
+    from, and the host and process in its header. A timer started in one file
+    and ended in another is not paired. */
+func ParseFilesToIntervals(filenames []string) []Interval {
+	var intervals []Interval = make([]Interval, 0)
+	for _, filename := range filenames {
+		var parsed []Interval = ParseMapToIntervals(ParseFileToMap([]string{filename}))
+		header, ok := ReadLogHeader(filename)
+		for i := range parsed {
+			parsed[i].Source = filename
+			if ok && parsed[i].ID == 0 {
+				parsed[i].Host, parsed[i].PID = header.Host, header.PID
+			}
+		}
+		intervals = append(intervals, parsed...)
+	}
+	sortIntervals(intervals)
+	return intervals
+}
+
+func sortIntervals(intervals []Interval) {
+	sort.SliceStable(intervals, func (i int, j int) bool {
+		if intervals[i].Start != intervals[j].Start {
+			return intervals[i].Start < intervals[j].Start
+		}
+		if intervals[i].Name != intervals[j].Name {
+			return intervals[i].Name < intervals[j].Name
+		}
+		return intervals[i].ID < intervals[j].ID
+	})
+}
@@ -0,0 +1,18 @@
+package timers
+
+import "testing"
+
+func TestIntervals1(t *testing.T) {
+	var tmap map[string]*TimerSummary = map[string]*TimerSummary{
+		"legacy": &TimerSummary{[]int64{10, 30}, []int64{20, 40}, nil},
+		"request": &TimerSummary{instances: map[uint64]*timerInstance{
+			7: &timerInstance{start: 15, end: 50, started: true, ended: true, outcome: OUTCOME_ERROR},
+			8: &timerInstance{start: 5, started: true},
+		}},
+	}
+	var intervals []Interval = ParseMapToIntervals(tmap)
+	if len(intervals) != 3 || intervals[0].Start != 10 || intervals[1].ID != 7 || intervals[1].Delta() != 35 || intervals[2].Name != "legacy" {
+		t.Logf("Bad intervals %v", intervals)
+		t.Fail()
+	}
+}
@@ -0,0 +1,210 @@
+package timers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+	)
+
+/* INTROSPECTION
+   Enumerates the timers in each backend, for debugging. */
+
+const (
+	STATE_RUNNING string = "running"
+	STATE_PAUSED string = "paused"
+	STATE_ENDED string = "ended"
+	STATE_UNSTARTED string = "unstarted" // ended but never started
+	STATE_CORRUPT string = "corrupt" // a file timer that can't be read
+	)
+
+type TimerInfo struct {
+	Name string
+	State string
+	Start int64 // UnixNano; for the buffered log, the oldest start still running if any
+	Elapsed int64 // time so far if running, otherwise the last measured delta; -1 if unknown
+}
+
+func sortInfos(infos []TimerInfo) []TimerInfo {
+	sort.Slice(infos, func (i int, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+/** Elapsed is active time, excluding pauses. */
+func ListTimers() []TimerInfo {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	var now int64 = time.Now().UnixNano()
+	var infos []TimerInfo = make([]TimerInfo, 0, len(timers))
+	for name, start := range timers {
+		var info TimerInfo = TimerInfo{Name: name, State: STATE_RUNNING, Start: start}
+		if _, ok := timersEnd[name]; ok {
+			info.State = STATE_ENDED
+			info.Elapsed = getTimerDelta(name)
+		} else {
+			if _, ok := timersPaused[name]; ok {
+				info.State = STATE_PAUSED
+			}
+			info.Elapsed = now - start - pausedTime(name, now)
+		}
+		infos = append(infos, info)
+	}
+	return sortInfos(infos)
+}
+
+/** Lists the timers in the current namespace, in either format, under their
+    original names. */
+func ListFileTimers() []TimerInfo {
+	names, _, err := scanFileTimerDir(timerDir)
+	if err != nil {
+		panic(fmt.Sprintf("Could not list file timers in %s: %v", timerDir, err))
+	}
+	var infos []TimerInfo = make([]TimerInfo, 0, len(names))
+	for _, name := range names {
+		if info, ok := fileTimerInfo(name); ok {
+			infos = append(infos, info)
+		}
+	}
+	return sortInfos(infos)
+}
+
+/** Returns the decoded names of the timers and namespaces in dir. Files this
+    package didn't write are ignored. */
+func scanFileTimerDir(dir string) (names []string, namespaces []string, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var seen map[string]bool = make(map[string]bool)
+	for _, entry := range entries {
+		var encoded string = entry.Name()
+		if strings.HasPrefix(encoded, ".") {
+			continue
+		} else if entry.IsDir() {
+		} else if strings.HasSuffix(encoded, FILE_TIMER_SUFFIX) {
+			encoded = strings.TrimSuffix(encoded, FILE_TIMER_SUFFIX)
+		} else if strings.HasSuffix(encoded, "_start") {
+			encoded = strings.TrimSuffix(encoded, "_start")
+		} else if strings.HasSuffix(encoded, "_end") {
+			encoded = strings.TrimSuffix(encoded, "_end")
+		} else {
+			continue
+		}
+		name, ok := decodeTimerName(encoded)
+		if !ok || validateTimerName(name) != nil || escapeTimerName(name) != encoded {
+			continue
+		}
+		if entry.IsDir() {
+			namespaces = append(namespaces, name)
+		} else if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(namespaces)
+	return names, namespaces, nil
+}
+
+/** Describes the timer's last run. Returns false for a timer that has only
+    been labelled. */
+func fileTimerInfo(name string) (TimerInfo, bool) {
+	var info TimerInfo = TimerInfo{Name: name, State: STATE_CORRUPT, Elapsed: -1}
+	record, err := loadFileTimer(name)
+	if err == ErrFileTimerMissing {
+		return info, false
+	} else if err != nil {
+		return info, true
+	}
+	var run *FileTimerRun = record.lastRun()
+	if run == nil || run.Start == 0 && run.End == 0 {
+		return info, false
+	}
+	info.Start = run.Start
+	if run.Start == 0 {
+		info.State = STATE_UNSTARTED
+	} else if run.End == 0 {
+		info.State = STATE_RUNNING
+		info.Elapsed = time.Now().UnixNano() - run.Start
+	} else {
+		info.State = STATE_ENDED
+		info.Elapsed = run.End - run.Start
+	}
+	return info, true
+}
+
+func ListBufferedLogTimers() []TimerInfo {
+	bufferLock.Lock()
+	defer bufferLock.Unlock()
+	var now int64 = time.Now().UnixNano()
+	var infos []TimerInfo = make([]TimerInfo, 0, len(bufferedTimers))
+	for name, summary := range bufferedTimers {
+		infos = append(infos, summaryInfo(name, summary, now))
+	}
+	return sortInfos(infos)
+}
+
+func summaryInfo(name string, summary *TimerSummary, now int64) TimerInfo {
+	var info TimerInfo = TimerInfo{Name: name, State: STATE_ENDED, Elapsed: -1}
+	var running bool = false
+	var lastEnd int64 = 0
+	if len(summary.starts) > len(summary.ends) {
+		running = true
+		info.Start = summary.starts[len(summary.ends)]
+	} else if len(summary.starts) != 0 && len(summary.starts) == len(summary.ends) {
+		info.Start = summary.starts[len(summary.starts) - 1]
+		lastEnd = summary.ends[len(summary.ends) - 1]
+		info.Elapsed = lastEnd - info.Start
+	}
+	for _, inst := range summary.instances {
+		if inst.started && !inst.ended {
+			if !running || inst.start < info.Start {
+				info.Start = inst.start
+			}
+			running = true
+		} else if !running && inst.started && inst.end > lastEnd {
+			info.Start = inst.start
+			lastEnd = inst.end
+			info.Elapsed = inst.end - inst.start
+		}
+	}
+	if running {
+		info.State = STATE_RUNNING
+		info.Elapsed = now - info.Start
+	} else if len(summary.starts) == 0 && len(summary.instances) == 0 {
+		info.State = STATE_UNSTARTED
+	}
+	return info
+}
+
+func dumpInfos(writer io.Writer, title string, infos []TimerInfo) error {
+	_, err := fmt.Fprintf(writer, "%s (%d):\n", title, len(infos))
+	for i := 0; err == nil && i < len(infos); i++ {
+		var elapsed string = "-"
+		if infos[i].Elapsed >= 0 {
+			elapsed = time.Duration(infos[i].Elapsed).String()
+		}
+		_, err = fmt.Fprintf(writer, "  %-32s %-10s %s\n", infos[i].Name, infos[i].State, elapsed)
+	}
+	return err
+}
+
+/** Writes every backend's timers in a human-readable form, e.g. for a debug
+    endpoint or a SIGQUIT handler. File timers are only listed if a collection
+    has been set. */
+func DumpTimers(writer io.Writer) error {
+	err := dumpInfos(writer, "Hashtable timers", ListTimers())
+	if err == nil && timerDir != "" {
+		err = dumpInfos(writer, fmt.Sprintf("File timers in %s", timerDir), ListFileTimers())
+		var namespaces []string = ListFileTimerNamespaces()
+		if err == nil && len(namespaces) != 0 {
+			_, err = fmt.Fprintf(writer, "  namespaces: %s\n", strings.Join(namespaces, ", "))
+		}
+	}
+	if err == nil {
+		err = dumpInfos(writer, "Buffered log timers", ListBufferedLogTimers())
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package timers
+
+import "bytes"
+import "strings"
+import "testing"
+
+func findInfo(infos []TimerInfo, name string) *TimerInfo {
+	for i := range infos {
+		if infos[i].Name == name {
+			return &infos[i]
+		}
+	}
+	return nil
+}
+
+func TestIntrospection1(t *testing.T) {
+	StartTimer("t1")
+	StartTimer("t2")
+	PauseTimer("t2")
+	StartTimer("t3")
+	EndTimer("t3")
+	var infos []TimerInfo = ListTimers()
+	if len(infos) != 3 || infos[0].Name != "t1" || infos[1].Name != "t2" || infos[2].Name != "t3" {
+		t.Logf("Bad listing %v", infos)
+		t.Fail()
+	} else if infos[0].State != STATE_RUNNING || infos[1].State != STATE_PAUSED || infos[2].State != STATE_ENDED {
+		t.Logf("Bad states %v", infos)
+		t.Fail()
+	} else if infos[2].Elapsed != GetTimerDelta("t3") {
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	DeleteTimer("t2")
+	DeleteTimer("t3")
+}
+
+func TestIntrospection2(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	StartFileTimer("intro1")
+	StartFileTimer("intro2")
+	EndFileTimer("intro2")
+	EndFileTimer("intro3")
+	LabelFileTimer("intro4", Labels{"a": "b"})
+	var infos []TimerInfo = ListFileTimers()
+	var i1, i2, i3, i4 *TimerInfo = findInfo(infos, "intro1"), findInfo(infos, "intro2"), findInfo(infos, "intro3"), findInfo(infos, "intro4")
+	if i1 == nil || i2 == nil || i3 == nil || i4 != nil {
+		t.Logf("Bad listing %v", infos)
+		t.Fail()
+	} else if i1.State != STATE_RUNNING || i2.State != STATE_ENDED || i3.State != STATE_UNSTARTED {
+		t.Logf("Bad states %v %v %v", i1, i2, i3)
+		t.Fail()
+	} else if i2.Elapsed != GetFileTimerDelta("intro2") {
+		t.Fail()
+	}
+	for _, name := range []string{"intro1", "intro2", "intro3", "intro4"} {
+		DeleteFileTimerIfExists(name)
+	}
+}
+
+func TestIntrospection3(t *testing.T) {
+	defer ResetLogBuffer()
+	StartBufferedLogTimer("t1")
+	StartBufferedLogTimer("t2")
+	EndBufferedLogTimer("t2")
+	StartBufferedLogHandle("t3")
+	StartBufferedLogHandle("t4").End()
+	EndBufferedLogTimer("t5")
+	var infos []TimerInfo = ListBufferedLogTimers()
+	var states []string = []string{STATE_RUNNING, STATE_ENDED, STATE_RUNNING, STATE_ENDED, STATE_UNSTARTED}
+	if len(infos) != len(states) {
+		t.Logf("Bad listing %v", infos)
+		t.Fail()
+		return
+	}
+	for i := range states {
+		if infos[i].State != states[i] {
+			t.Logf("Timer %s is %s, expected %s", infos[i].Name, infos[i].State, states[i])
+			t.Fail()
+		}
+	}
+	StartTimer("t1")
+	var buf bytes.Buffer
+	DumpTimers(&buf)
+	DeleteTimer("t1")
+	if !strings.Contains(buf.String(), "Hashtable timers (1):") || !strings.Contains(buf.String(), "Buffered log timers (5):") {
+		t.Logf("Bad dump %s", buf.String())
+		t.Fail()
+	}
+}
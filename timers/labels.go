@@ -0,0 +1,204 @@
+package timers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	)
+
+/* LABELS
+   Key/value pairs attached to a timer, so that things like endpoint and status
+   don't have to be encoded into the timer name. Keys and values can't contain \0.
+   A record holds at most MAX_LABELS of them. Hashtable timers, file timers and
+   handles can be labelled. StartLogTimer and StartBufferedLogTimer pair starts
+   and ends by position, with no instance for labels to belong to, so log timers
+   are labelled with StartLabelledLogTimer and StartLabelledBufferedLogTimer,
+   which record handles but are ended by name. */
+
+const MAX_LABELS int = 65535 // the count is a uint16
+
+type Labels map[string]string
+
+func (labels Labels) merge(other Labels) {
+	for k, v := range other {
+		labels[k] = v
+	}
+}
+
+func (labels Labels) copy() Labels {
+	var c Labels = make(Labels, len(labels))
+	c.merge(labels)
+	return c
+}
+
+/** The log format terminates keys and values with \0, so they can't contain it. */
+func checkLabels(name string, labels Labels) {
+	if len(labels) > MAX_LABELS {
+		panic(fmt.Sprintf("Attempted to label timer %s with %d labels, more than %d", name, len(labels), MAX_LABELS))
+	}
+	for k, v := range labels {
+		if strings.IndexByte(k, 0) != -1 || strings.IndexByte(v, 0) != -1 {
+			panic(fmt.Sprintf("Attempted to label timer %s with %q=%q, which contains \\0", name, k, v))
+		}
+	}
+}
+
+func (labels Labels) sortedKeys() []string {
+	var keys []string = make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/** A uint16 count followed by that many NUL-terminated keys and values. */
+func (labels Labels) encode() []byte {
+	if len(labels) > MAX_LABELS {
+		panic(fmt.Sprintf("Attempted to encode %d labels, more than %d", len(labels), MAX_LABELS))
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(len(labels)))
+	for _, k := range labels.sortedKeys() {
+		buf.WriteString(k)
+		buf.WriteByte(0)
+		buf.WriteString(labels[k])
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func readLabels(freader *bufio.Reader) (Labels, error) {
+	var count uint16
+	err := binary.Read(freader, binary.LittleEndian, &count)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var labels Labels = make(Labels, count)
+	var k, v string
+	for i := 0; i < int(count); i++ {
+		k, err = freader.ReadString('\x00')
+		if err == nil {
+			v, err = freader.ReadString('\x00')
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		labels[k[:len(k) - 1]] = v[:len(v) - 1]
+	}
+	return labels, nil
+}
+
+/** Formats the group a timer falls into, e.g. request{endpoint=/users,status=200}.
+    Keys the timer doesn't have get an empty value. */
+func groupKey(name string, labels Labels, keys []string) string {
+	if len(keys) == 0 {
+		return name
+	}
+	var parts []string = make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%s", k, labels[k])
+	}
+	return fmt.Sprintf("%s{%s}", name, strings.Join(parts, ","))
+}
+
+/** Like ParseMapToDeltas, but splits each timer into one group per distinct
+    combination of values for the given label keys. Starts and ends without an
+    instance ID carry no labels. */
+func ParseMapToDeltasByLabels(tmap map[string]*TimerSummary, keys ...string) map[string][]int64 {
+	var deltamap map[string][]int64 = make(map[string][]int64)
+	var key string
+	for tname, tsummary := range tmap {
+		if deltas := positionalDeltas(tname, tsummary); len(deltas) != 0 {
+			key = groupKey(tname, nil, keys)
+			deltamap[key] = append(deltamap[key], deltas...)
+		}
+		for _, inst := range completeInstances(tname, tsummary) {
+			key = groupKey(tname, inst.labels, keys)
+			deltamap[key] = append(deltamap[key], inst.end - inst.start)
+		}
+	}
+	return deltamap
+}
+
+/** Labels can be added to a handle at any point, including just before End. */
+func (h *Handle) AddLabels(labels Labels) {
+	checkLabels(h.name, labels)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.labels == nil {
+		h.labels = make(Labels)
+	}
+	h.labels.merge(labels)
+	if h.record != nil {
+		h.record(&logRecord{name: h.name, symbol: LABEL_SYMBOL, time: time.Now().UnixNano(), id: h.id, labels: labels})
+	}
+}
+
+func (h *Handle) EndWithLabels(labels Labels) int64 {
+	h.AddLabels(labels)
+	return h.End()
+}
+
+func (h *Handle) Labels() Labels {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.labels.copy()
+}
+
+/* LABELLED LOG TIMERS
+   Log timers that are started and ended by name, like StartLogTimer, but carry
+   labels. Each run is recorded as a handle, and runs of the same name end in
+   the order they were started. */
+
+var labelledLock sync.Mutex
+var labelledLogHandles map[string][]*Handle = make(map[string][]*Handle)
+var labelledBufferedHandles map[string][]*Handle = make(map[string][]*Handle)
+
+func startLabelled(handles map[string][]*Handle, start func(string) *Handle, name string, labels Labels) {
+	checkLabels(name, labels)
+	var h *Handle = start(name)
+	h.AddLabels(labels)
+	labelledLock.Lock()
+	handles[name] = append(handles[name], h)
+	labelledLock.Unlock()
+}
+
+func endLabelled(handles map[string][]*Handle, name string) int64 {
+	labelledLock.Lock()
+	var running []*Handle = handles[name]
+	if len(running) == 0 {
+		labelledLock.Unlock()
+		panic(fmt.Sprintf("Attempted to end labelled timer %s, which is not running", name))
+	}
+	var h *Handle = running[0]
+	if len(running) == 1 {
+		delete(handles, name)
+	} else {
+		handles[name] = running[1:]
+	}
+	labelledLock.Unlock()
+	return h.End()
+}
+
+func StartLabelledLogTimer(name string, labels Labels) {
+	startLabelled(labelledLogHandles, StartLogHandle, name, labels)
+}
+
+/** Ends the oldest run of the timer and returns its duration. */
+func EndLabelledLogTimer(name string) int64 {
+	return endLabelled(labelledLogHandles, name)
+}
+
+func StartLabelledBufferedLogTimer(name string, labels Labels) {
+	startLabelled(labelledBufferedHandles, StartBufferedLogHandle, name, labels)
+}
+
+func EndLabelledBufferedLogTimer(name string) int64 {
+	return endLabelled(labelledBufferedHandles, name)
+}
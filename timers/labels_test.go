@@ -0,0 +1,162 @@
+package timers
+
+import "os"
+import "strconv"
+import "testing"
+
+func TestLabels1(t *testing.T) {
+	StartTimer("t1")
+	LabelTimer("t1", Labels{"endpoint": "/users"})
+	EndTimer("t1")
+	LabelTimer("t1", Labels{"status": "200"})
+	var labels Labels = GetTimerLabels("t1")
+	if len(labels) != 2 || labels["endpoint"] != "/users" || labels["status"] != "200" {
+		t.Logf("Bad labels %v", labels)
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	if len(GetTimerLabels("t1")) != 0 {
+		t.Log("Labels survived DeleteTimer")
+		t.Fail()
+	}
+}
+
+func TestLabels2(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	StartFileTimer("t1")
+	LabelFileTimer("t1", Labels{"endpoint": "/users", "status": "500"})
+	EndFileTimer("t1")
+	LabelFileTimer("t1", Labels{"status": "200"})
+	var labels Labels = GetFileTimerLabels("t1")
+	if len(labels) != 2 || labels["endpoint"] != "/users" || labels["status"] != "200" {
+		t.Logf("Bad labels %v", labels)
+		t.Fail()
+	}
+	DeleteFileTimer("t1")
+	if len(GetFileTimerLabels("t1")) != 0 {
+		t.Log("Labels survived DeleteFileTimer")
+		t.Fail()
+	}
+}
+
+func TestLabels3(t *testing.T) {
+	SetLogFile("/home/sam/timers/labellog")
+	var h *Handle
+	for _, status := range []string{"200", "200", "404"} {
+		h = StartLogHandle("request")
+		h.AddLabels(Labels{"endpoint": "/users"})
+		h.EndWithLabels(Labels{"status": status})
+	}
+	h = StartLogHandle("request")
+	h.EndWithLabels(Labels{"endpoint": "/login", "status": "200"})
+	StartLogTimer("request")
+	EndLogTimer("request")
+	CloseLogFile()
+	var tmap map[string]*TimerSummary = ParseFileToMap([]string{"/home/sam/timers/labellog"})
+	var bystatus map[string][]int64 = ParseMapToDeltasByLabels(tmap, "status")
+	if len(bystatus) != 3 || len(bystatus["request{status=200}"]) != 3 || len(bystatus["request{status=404}"]) != 1 || len(bystatus["request{status=}"]) != 1 {
+		t.Logf("Bad grouping by status %v", bystatus)
+		t.Fail()
+	}
+	var byboth map[string][]int64 = ParseMapToDeltasByLabels(tmap, "endpoint", "status")
+	if len(byboth["request{endpoint=/users,status=200}"]) != 2 || len(byboth["request{endpoint=/login,status=200}"]) != 1 {
+		t.Logf("Bad grouping by endpoint and status %v", byboth)
+		t.Fail()
+	}
+	if len(ParseMapToDeltasByLabels(tmap)["request"]) != 5 {
+		t.Fail()
+	}
+}
+
+func TestLabels4(t *testing.T) {
+	defer ResetLogBuffer()
+	var h *Handle = StartBufferedLogHandle("request")
+	h.AddLabels(Labels{"endpoint": "/users"})
+	h.EndWithLabels(Labels{"status": "200"})
+	if labels := h.Labels(); len(labels) != 2 {
+		t.Logf("Bad handle labels %v", labels)
+		t.Fail()
+	}
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/labelbuffer")
+	WriteLogBuffer(f)
+	f.Close()
+	var tmap map[string]*TimerSummary = ParseFileToMap([]string{"/home/sam/timers/labelbuffer"})
+	if len(ParseMapToDeltasByLabels(tmap, "endpoint", "status")["request{endpoint=/users,status=200}"]) != 1 {
+		t.Log("Labels lost when writing the buffer")
+		t.Fail()
+	}
+}
+
+func TestLabels5(t *testing.T) {
+	defer ResetLogBuffer()
+	var h *Handle = StartBufferedLogHandle("request")
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished || len(h.Labels()) != 0 {
+				t.Fail()
+			}
+		}()
+	StartTimer("t1")
+	defer DeleteTimer("t1")
+	func () {
+			defer func () {
+					if recover() == nil {
+						t.Log("Hashtable timer accepted a label containing \\0")
+						t.Fail()
+					}
+				}()
+			LabelTimer("t1", Labels{"a\x00b": "c"})
+		}()
+	finished = true
+	h.AddLabels(Labels{"endpoint": "/users\x00"})
+}
+
+func TestLabels6(t *testing.T) {
+	defer ResetLogBuffer()
+	StartLabelledBufferedLogTimer("request", Labels{"endpoint": "/users"})
+	StartLabelledBufferedLogTimer("request", Labels{"endpoint": "/login"})
+	if EndLabelledBufferedLogTimer("request") < 0 {
+		t.Fail()
+	}
+	EndLabelledBufferedLogTimer("request")
+	var grouped map[string][]int64 = ParseMapToDeltasByLabels(GetLogBuffer(), "endpoint")
+	if len(grouped["request{endpoint=/users}"]) != 1 || len(grouped["request{endpoint=/login}"]) != 1 {
+		t.Logf("Bad labelled buffered timers %v", grouped)
+		t.Fail()
+	}
+	SetLogFile("/home/sam/timers/labelledlog")
+	StartLabelledLogTimer("request", Labels{"endpoint": "/users"})
+	EndLabelledLogTimer("request")
+	CloseLogFile()
+	grouped = ParseMapToDeltasByLabels(ParseFileToMap([]string{"/home/sam/timers/labelledlog"}), "endpoint")
+	if len(grouped["request{endpoint=/users}"]) != 1 {
+		t.Logf("Bad labelled log timers %v", grouped)
+		t.Fail()
+	}
+	os.Remove("/home/sam/timers/labelledlog")
+
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+		}()
+	var many Labels = make(Labels, MAX_LABELS + 1)
+	for i := 0; i <= MAX_LABELS; i++ {
+		many[strconv.Itoa(i)] = ""
+	}
+	func () {
+			defer func () {
+					if recover() == nil {
+						t.Log("Accepted more labels than a record can hold")
+						t.Fail()
+					}
+				}()
+			StartLabelledBufferedLogTimer("request", many)
+		}()
+	finished = true
+	EndLabelledBufferedLogTimer("request")
+}
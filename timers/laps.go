@@ -0,0 +1,74 @@
+package timers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	)
+
+/* LAPS
+   Named split points on a running timer, e.g. "parse", "validate", "commit" for
+   the phases of one operation. */
+
+type Lap struct {
+	Name string
+	Time int64 // when the lap was taken, in UnixNano
+	Split int64 // time since the previous lap, or since the start for the first, including pauses
+}
+
+/** Returns the laps ordered by time with Split filled in. */
+func splitLaps(start int64, laps []Lap) []Lap {
+	var sorted []Lap = append([]Lap(nil), laps...)
+	sort.SliceStable(sorted, func (i int, j int) bool { return sorted[i].Time < sorted[j].Time })
+	var prev int64 = start
+	for i := range sorted {
+		sorted[i].Split = sorted[i].Time - prev
+		prev = sorted[i].Time
+	}
+	return sorted
+}
+
+/** For each timer, the split durations of each named lap across all complete
+    instances. */
+func ParseMapToLapDeltas(tmap map[string]*TimerSummary) map[string]map[string][]int64 {
+	var lapmap map[string]map[string][]int64 = make(map[string]map[string][]int64)
+	for tname, tsummary := range tmap {
+		for _, inst := range completeInstances(tname, tsummary) {
+			if len(inst.laps) == 0 {
+				continue
+			}
+			if lapmap[tname] == nil {
+				lapmap[tname] = make(map[string][]int64)
+			}
+			for _, lap := range splitLaps(inst.start, inst.laps) {
+				lapmap[tname][lap.Name] = append(lapmap[tname][lap.Name], lap.Split)
+			}
+		}
+	}
+	return lapmap
+}
+
+func (h *Handle) Lap(lapName string) int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.ended {
+		panic(fmt.Sprintf("Attempted to lap stopped timer %s (instance %d)", h.name, h.id))
+	}
+	var lap Lap = Lap{lapName, time.Now().UnixNano(), 0}
+	if len(h.laps) == 0 {
+		lap.Split = lap.Time - h.start
+	} else {
+		lap.Split = lap.Time - h.laps[len(h.laps) - 1].Time
+	}
+	h.laps = append(h.laps, lap)
+	if h.record != nil {
+		h.record(&logRecord{name: h.name, symbol: LAP_SYMBOL, time: lap.Time, id: h.id, lap: lapName})
+	}
+	return lap.Split
+}
+
+func (h *Handle) Laps() []Lap {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]Lap(nil), h.laps...)
+}
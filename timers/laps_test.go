@@ -0,0 +1,108 @@
+package timers
+
+import "bytes"
+import "bufio"
+import "fmt"
+import "strings"
+import "testing"
+
+func TestLaps1(t *testing.T) {
+	StartTimer("t1")
+	expFibonacci(20)
+	var parse int64 = LapTimer("t1", "parse")
+	expFibonacci(20)
+	var validate int64 = LapTimer("t1", "validate")
+	LapTimer("t1", "commit")
+	var laps []Lap = GetTimerLaps("t1")
+	if len(laps) != 3 || laps[0].Name != "parse" || laps[1].Name != "validate" || laps[2].Name != "commit" {
+		t.Logf("Bad laps %v", laps)
+		t.Fail()
+		DeleteTimer("t1")
+		return
+	}
+	if laps[0].Split != parse || laps[1].Split != validate || laps[1].Time - laps[0].Time != validate {
+		t.Logf("Bad splits %v", laps)
+		t.Fail()
+	}
+	ResetTimer("t1")
+	if len(GetTimerLaps("t1")) != 0 {
+		t.Log("Laps survived ResetTimer")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+}
+
+func TestLaps2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteTimer("t1")
+		}()
+	StartTimer("t1")
+	LapTimer("t1", "a")
+	EndTimer("t1")
+	finished = true
+	LapTimer("t1", "b")
+}
+
+func TestLaps3(t *testing.T) {
+	StartTimer("t1")
+	LabelTimer("t1", Labels{"endpoint": "/users"})
+	LapTimer("t1", "parse")
+	LapTimer("t1", "commit")
+	EndTimer("t1")
+	var buf bytes.Buffer
+	WriteTimerLog(&buf, "t1")
+	var h *Handle = Start("t1")
+	h.Lap("parse")
+	h.Lap("commit")
+	h.End()
+	var tmap map[string]*TimerSummary = make(map[string]*TimerSummary)
+	var freader *bufio.Reader = bufio.NewReader(&buf)
+	for rec, err := readRecord(freader); err == nil; rec, err = readRecord(freader) {
+		if tmap[rec.name] == nil {
+			tmap[rec.name] = newTimerSummary(1)
+		}
+		applyRecord(tmap[rec.name], rec)
+	}
+	var lapdeltas map[string]map[string][]int64 = ParseMapToLapDeltas(tmap)
+	var laps []Lap = GetTimerLaps("t1")
+	if len(lapdeltas["t1"]["parse"]) != 1 || lapdeltas["t1"]["parse"][0] != laps[0].Split || lapdeltas["t1"]["commit"][0] != laps[1].Split {
+		t.Logf("Bad lap deltas %v for laps %v", lapdeltas, laps)
+		t.Fail()
+	}
+	if len(ParseMapToDeltasByLabels(tmap, "endpoint")["t1{endpoint=/users}"]) != 1 {
+		t.Log("Labels lost when writing the timer")
+		t.Fail()
+	}
+	if len(h.Laps()) != 2 {
+		t.Fail()
+	}
+	DeleteTimer("t1")
+}
+
+func TestLaps4(t *testing.T) {
+	StartTimer("t1")
+	var first, second bytes.Buffer
+	WriteTimerLog(&first, "t1")
+	EndTimer("t1")
+	WriteTimerLog(&second, "t1")
+	DeleteTimer("t1")
+	rec1, err1 := readRecord(bufio.NewReader(&first))
+	rec2, err2 := readRecord(bufio.NewReader(&second))
+	if err1 != nil || err2 != nil || rec1.id == 0 || rec1.id != rec2.id {
+		t.Log("Writes of the same run have different instance IDs")
+		t.Fail()
+	}
+	defer func () {
+			r := recover()
+			if r == nil || !strings.Contains(fmt.Sprint(r), "does not exist") {
+				t.Logf("Bad panic %v", r)
+				t.Fail()
+			}
+		}()
+	WriteTimerLog(&first, "t1")
+}
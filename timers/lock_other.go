@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package timers
+
+import "sync"
+
+var collectionLock sync.Mutex
+
+/** Without flock, file timers are only locked against other goroutines in this
+    process. */
+func lockFileCollection() func() {
+	collectionLock.Lock()
+	return collectionLock.Unlock
+}
@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package timers
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	)
+
+/** Takes an exclusive advisory lock on the current collection, including all of
+    its namespaces, shared with any other process using the same directory. Call
+    the returned function to release it. */
+func lockFileCollection() func() {
+	f, err := os.OpenFile(timerRoot + "/" + LOCK_FILE_NAME, os.O_CREATE | os.O_RDWR, 0644)
+	if err != nil {
+		panic(fmt.Sprintf("Could not open lock for timer collection %s: %v", timerRoot, err))
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		panic(fmt.Sprintf("Could not lock timer collection %s: %v", timerRoot, err))
+	}
+	return func () {
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+		}
+}
@@ -0,0 +1,99 @@
+package timers
+
+/* MEASURE AND TIME HELPERS
+   Measure is meant to be deferred, as in defer timers.Measure("name")(), and
+   Time wraps a function call. Both always end the timer, even on a panic, and
+   tag it with OUTCOME_SUCCESS, OUTCOME_ERROR or OUTCOME_PANIC. */
+
+/** A backend starts a timer and returns the function that ends it. */
+type backend func(name string) func(Outcome)
+
+/** Unlike StartTimer, this restarts a timer that has ended, so that a measured
+    function can run more than once. */
+func hashTableBackend(name string) func(Outcome) {
+	func () {
+			timersLock.Lock()
+			defer timersLock.Unlock()
+			restartTimer(name)
+		}()
+	return func (outcome Outcome) {
+			endTimerWithOutcome(name, outcome)
+		}
+}
+
+func fileBackend(name string) func(Outcome) {
+	StartFileTimer(name)
+	return func (outcome Outcome) {
+			endFileTimerWithOutcome(name, outcome)
+		}
+}
+
+func handleBackend(start func(string) *Handle) backend {
+	return func (name string) func(Outcome) {
+			var h *Handle = start(name)
+			return func (outcome Outcome) {
+					h.EndWithOutcome(outcome)
+				}
+		}
+}
+
+/** The returned function must be deferred directly for panics to be seen. It
+    records the panic and then resumes panicking. */
+func measure(start backend, name string) func() {
+	var end func(Outcome) = start(name)
+	return func () {
+			if r := recover(); r != nil {
+				end(OUTCOME_PANIC)
+				panic(r)
+			}
+			end(OUTCOME_SUCCESS)
+		}
+}
+
+func timeFunc(start backend, name string, fn func() error) (err error) {
+	var end func(Outcome) = start(name)
+	var outcome Outcome = OUTCOME_PANIC // unless fn returns
+	defer func () {
+			end(outcome)
+		}()
+	err = fn()
+	if err != nil {
+		outcome = OUTCOME_ERROR
+	} else {
+		outcome = OUTCOME_SUCCESS
+	}
+	return
+}
+
+func Measure(name string) func() {
+	return measure(hashTableBackend, name)
+}
+
+func MeasureFile(name string) func() {
+	return measure(fileBackend, name)
+}
+
+func MeasureLog(name string) func() {
+	return measure(handleBackend(StartLogHandle), name)
+}
+
+func MeasureBufferedLog(name string) func() {
+	return measure(handleBackend(StartBufferedLogHandle), name)
+}
+
+/** Returns whatever fn returns. */
+func Time(name string, fn func() error) error {
+	return timeFunc(hashTableBackend, name, fn)
+}
+
+func TimeFile(name string, fn func() error) error {
+	return timeFunc(fileBackend, name, fn)
+}
+
+func TimeLog(name string, fn func() error) error {
+	return timeFunc(handleBackend(StartLogHandle), name, fn)
+}
+
+func TimeBufferedLog(name string, fn func() error) error {
+	return timeFunc(handleBackend(StartBufferedLogHandle), name, fn)
+}
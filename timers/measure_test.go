@@ -0,0 +1,106 @@
+package timers
+
+import "errors"
+import "testing"
+
+func measured(name string, fail bool) {
+	defer Measure(name)()
+	if fail {
+		panic("failed")
+	}
+}
+
+func TestMeasure1(t *testing.T) {
+	measured("t1", false)
+	func () {
+			defer func () {
+					if recover() == nil {
+						t.Log("Measure swallowed the panic")
+						t.Fail()
+					}
+				}()
+			measured("t2", true)
+		}()
+	if GetTimerDelta("t1") < 0 || GetTimerOutcome("t1") != OUTCOME_SUCCESS {
+		t.Fail()
+	}
+	if GetTimerDelta("t2") < 0 || GetTimerOutcome("t2") != OUTCOME_PANIC {
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	DeleteTimer("t2")
+	if GetTimerOutcome("t1") != OUTCOME_NONE {
+		t.Log("Outcome survived DeleteTimer")
+		t.Fail()
+	}
+}
+
+func TestMeasure2(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	var failure error = errors.New("failed")
+	if TimeFile("t1", func () error { return failure }) != failure {
+		t.Fail()
+	}
+	TimeFile("t2", func () error { return nil })
+	if GetFileTimerDelta("t1") < 0 || GetFileTimerOutcome("t1") != OUTCOME_ERROR {
+		t.Fail()
+	}
+	if GetFileTimerOutcome("t2") != OUTCOME_SUCCESS {
+		t.Fail()
+	}
+	EndFileTimer("t2")
+	if GetFileTimerOutcome("t2") != OUTCOME_NONE {
+		t.Log("Plain end kept the old outcome")
+		t.Fail()
+	}
+	DeleteFileTimer("t1")
+	DeleteFileTimer("t2")
+}
+
+func TestMeasure3(t *testing.T) {
+	defer ResetLogBuffer()
+	TimeBufferedLog("ok", func () error { return nil })
+	TimeBufferedLog("err", func () error { return errors.New("failed") })
+	func () {
+			defer func () {
+					recover()
+				}()
+			TimeBufferedLog("panic", func () error { panic("failed") })
+		}()
+	var expected map[string]Outcome = map[string]Outcome{"ok": OUTCOME_SUCCESS, "err": OUTCOME_ERROR, "panic": OUTCOME_PANIC}
+	for name, outcome := range expected {
+		var summary *TimerSummary = GetLogBuffer()[name]
+		if summary == nil || len(summary.instances) != 1 {
+			t.Logf("Timer %s missing from buffer", name)
+			t.Fail()
+			continue
+		}
+		for _, inst := range summary.instances {
+			if !inst.ended || inst.outcome != outcome {
+				t.Logf("Timer %s has outcome %v, expected %v", name, inst.outcome, outcome)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestMeasure4(t *testing.T) {
+	measured("t1", false)
+	measured("t1", false)
+	if Time("t1", func () error { return errors.New("failed") }) == nil || GetTimerOutcome("t1") != OUTCOME_ERROR {
+		t.Log("Measured timer could not be restarted")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	func () {
+			defer func () {
+					if recover() == nil {
+						t.Log("Restarted a running timer")
+						t.Fail()
+					}
+				}()
+			StartTimer("t2")
+			defer DeleteTimer("t2")
+			measured("t2", false)
+		}()
+}
@@ -0,0 +1,132 @@
+package timers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	)
+
+/* MERGING LOGS FROM SEVERAL HOSTS
+   ParseFileToMap treats its files as one log, which breaks when they come from
+   different machines: their clocks disagree, and starts and ends without an
+   instance ID get paired across hosts. MergeLogFiles pairs those within each
+   file, shifts each file onto a common clock, and keeps the file, host and
+   process of every instance so that intervals can be traced to their origin. */
+
+type LogHeader struct {
+	Host string
+	PID int
+	Time int64 // when the log was opened
+}
+
+type MergeOptions struct {
+	/** Nanoseconds added to every time in a file to bring it onto the reference
+	    clock, keyed by file name or by the host in the file's header. An entry
+	    for the file name takes precedence, and a file without a header, or
+	    whose header has no host, is only looked up by its name. */
+	Offsets map[string]int64
+}
+
+func (options MergeOptions) offset(fname string, host string) int64 {
+	if offset, ok := options.Offsets[fname]; ok {
+		return offset
+	}
+	if host == "" {
+		return 0
+	}
+	return options.Offsets[host]
+}
+
+/** Returns the header of a log file, or false if it has none, as with logs
+    written before headers were added. */
+func ReadLogHeader(fname string) (LogHeader, bool) {
+	f, err := os.Open(fname)
+	if err != nil {
+		panic(fmt.Sprintf("Attempted to parse file at invalid filepath %s", fname))
+	}
+	defer f.Close()
+	rec, err := readRecord(bufio.NewReader(f))
+	if err != nil || rec.symbol != HEADER_SYMBOL {
+		return LogHeader{}, false
+	}
+	return LogHeader{rec.name, rec.pid, rec.time}, true
+}
+
+func MergeLogFiles(filenames []string, options MergeOptions) map[string]*TimerSummary {
+	var tmap map[string]*TimerSummary = make(map[string]*TimerSummary)
+	for _, fname := range filenames {
+		var fmap map[string]*TimerSummary = make(map[string]*TimerSummary)
+		var origin *timerInstance = &timerInstance{source: fname}
+		var offset int64 = options.offset(fname, "")
+		readLogFile(fname, func (rec *logRecord) {
+			if rec.symbol == HEADER_SYMBOL {
+				origin.host, origin.pid = rec.name, rec.pid
+				offset = options.offset(fname, rec.name)
+				return
+			}
+			rec.time += offset
+			summary, ok := fmap[rec.name]
+			if !ok {
+				summary = newTimerSummary(1)
+				fmap[rec.name] = summary
+			}
+			applyRecord(summary, rec)
+			attributeRecord(summary, rec, origin)
+		})
+		for name, fsummary := range fmap {
+			summary, ok := tmap[name]
+			if !ok {
+				summary = newTimerSummary(0)
+				tmap[name] = summary
+			}
+			mergeSummary(name, summary, fsummary, origin)
+		}
+	}
+	return tmap
+}
+
+/** Starts and ends without an instance ID that pair cleanly within their file
+    become instances; otherwise they are kept as they are, so that
+    ParseMapToDeltas reports the problem. */
+func mergeSummary(name string, summary *TimerSummary, fsummary *TimerSummary, origin *timerInstance) {
+	var anomalous bool = false
+	var deltas []int64 = pairPositional(name, fsummary, func (Anomaly) { anomalous = true })
+	if anomalous {
+		summary.starts = append(summary.starts, fsummary.starts...)
+		summary.ends = append(summary.ends, fsummary.ends...)
+	}
+	for i := range deltas {
+		var inst *timerInstance = summary.getInstance(nextInstanceID())
+		inst.start, inst.end = fsummary.starts[i], fsummary.ends[i]
+		inst.started, inst.ended = true, true
+		inst.source, inst.host, inst.pid = origin.source, origin.host, origin.pid
+	}
+	for id, finst := range fsummary.instances {
+		mergeInstance(summary.getInstance(id), finst)
+	}
+}
+
+/** An instance may be started in one file and ended in another, e.g. when a
+    log is rotated. */
+func mergeInstance(inst *timerInstance, other *timerInstance) {
+	if inst.source == "" || other.started {
+		inst.source, inst.host, inst.pid = other.source, other.host, other.pid
+	}
+	if other.started {
+		inst.start, inst.started = other.start, true
+	}
+	if other.ended {
+		inst.end, inst.ended, inst.outcome = other.end, true, other.outcome
+	}
+	if len(other.labels) != 0 {
+		if inst.labels == nil {
+			inst.labels = make(Labels)
+		}
+		inst.labels.merge(other.labels)
+	}
+	if len(other.laps) != 0 {
+		inst.laps = append(inst.laps, other.laps...)
+		sort.SliceStable(inst.laps, func (i int, j int) bool { return inst.laps[i].Time < inst.laps[j].Time })
+	}
+}
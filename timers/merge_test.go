@@ -0,0 +1,97 @@
+package timers
+
+import "os"
+import "testing"
+
+/** Writes a log as if from another host, whose clock is off by skew nanoseconds. */
+func writeHostLog(fname string, host string, skew int64, records []*logRecord) {
+	var f *os.File
+	f, _ = os.Create(fname)
+	f.Write((&logRecord{name: host, symbol: HEADER_SYMBOL, time: skew, pid: 42}).encode())
+	for _, rec := range records {
+		rec.time += skew
+		f.Write(rec.encode())
+	}
+	f.Close()
+}
+
+func TestMerge1(t *testing.T) {
+	var skew int64 = -1000000 // beta is behind, so its job appears to start before alpha's ends
+	writeHostLog("/home/sam/timers/mergea", "alpha", 0, []*logRecord{
+		&logRecord{name: "job", symbol: START_SYMBOL, time: 100},
+		&logRecord{name: "job", symbol: END_SYMBOL, time: 300},
+		&logRecord{name: "rpc", symbol: START_INSTANCE_SYMBOL, time: 150, id: 7},
+	})
+	writeHostLog("/home/sam/timers/mergeb", "beta", skew, []*logRecord{
+		&logRecord{name: "job", symbol: START_SYMBOL, time: 200},
+		&logRecord{name: "job", symbol: END_SYMBOL, time: 250},
+		&logRecord{name: "rpc", symbol: END_INSTANCE_SYMBOL, time: 400, id: 7},
+	})
+	var files []string = []string{"/home/sam/timers/mergea", "/home/sam/timers/mergeb"}
+
+	header, ok := ReadLogHeader("/home/sam/timers/mergeb")
+	if !ok || header.Host != "beta" || header.PID != 42 || header.Time != skew {
+		t.Logf("Bad header %v", header)
+		t.Fail()
+	}
+	var parsed []Interval = ParseFilesToIntervals([]string{"/home/sam/timers/mergeb"})
+	if len(parsed) != 1 || parsed[0].Name != "job" || parsed[0].Host != "beta" || parsed[0].PID != 42 {
+		t.Logf("Header not attributed to positional intervals: %v", parsed)
+		t.Fail()
+	}
+	if deltas := ParseMapToDeltas(ParseFileToMap(files)); len(deltas["job"]) != 0 {
+		t.Log("Concatenated logs from two hosts should not pair")
+		t.Fail()
+	}
+
+	var intervals []Interval = ParseMapToIntervals(MergeLogFiles(files, MergeOptions{Offsets: map[string]int64{"beta": -skew}}))
+	if len(intervals) != 3 {
+		t.Logf("Bad intervals %v", intervals)
+		t.Fail()
+		return
+	}
+	var jobA, rpc, jobB Interval = intervals[0], intervals[1], intervals[2]
+	if jobA.Host != "alpha" || jobA.Delta() != 200 || jobB.Host != "beta" || jobB.Start != 200 || jobB.Source != "/home/sam/timers/mergeb" {
+		t.Logf("Bad job intervals %v", intervals)
+		t.Fail()
+	}
+	if rpc.Name != "rpc" || rpc.ID != 7 || rpc.Delta() != 250 || rpc.Host != "alpha" || rpc.PID != 42 {
+		t.Logf("Instance split across hosts merged incorrectly: %v", rpc)
+		t.Fail()
+	}
+
+	intervals = ParseMapToIntervals(MergeLogFiles(files, MergeOptions{Offsets: map[string]int64{"/home/sam/timers/mergeb": -skew + 50}}))
+	if len(intervals) != 3 || intervals[2].Start != 250 {
+		t.Logf("File offset did not take precedence: %v", intervals)
+		t.Fail()
+	}
+}
+
+func TestMerge2(t *testing.T) {
+	SetLogFile("/home/sam/timers/mergelocal")
+	StartLogTimer("t")
+	CloseLogFile()
+	header, ok := ReadLogHeader("/home/sam/timers/mergelocal")
+	if !ok || header.Host != hostname || header.PID != os.Getpid() {
+		t.Logf("Bad header %v", header)
+		t.Fail()
+	}
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/mergeold")
+	f.Write((&logRecord{name: "t", symbol: START_SYMBOL, time: 1}).encode())
+	f.Close()
+	if _, ok = ReadLogHeader("/home/sam/timers/mergeold"); ok {
+		t.Log("Found a header in a log without one")
+		t.Fail()
+	}
+	var tmap map[string]*TimerSummary = MergeLogFiles([]string{"/home/sam/timers/mergelocal", "/home/sam/timers/mergeold"}, MergeOptions{})
+	if len(tmap["t"].starts) != 2 || len(tmap["t"].instances) != 0 {
+		t.Log("Unpaired starts were not kept for ParseMapToDeltas to report")
+		t.Fail()
+	}
+	tmap = MergeLogFiles([]string{"/home/sam/timers/mergeold"}, MergeOptions{map[string]int64{"": 1000}})
+	if tmap["t"].starts[0] != 1 {
+		t.Logf("Log without a header was shifted by %d", tmap["t"].starts[0] - 1)
+		t.Fail()
+	}
+}
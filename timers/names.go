@@ -0,0 +1,105 @@
+package timers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	)
+
+/* FILE TIMER NAMES
+   Timer names are encoded before being used as file names, so that any name is
+   safe to use with a file timer and can be recovered from the directory
+   listing. Letters, digits, '-', '_' and '.' are kept as they are; every other
+   byte becomes %XX, as do a leading '.' and the first letter of a name that
+   Windows reserves for devices. Names that are already safe are unchanged, so
+   timers written before encoding was introduced are still found.
+
+   Letters keep their case, so on a case-insensitive filesystem, such as the
+   defaults on macOS and Windows, "Foo" and "foo" are the same file and the two
+   timers will overwrite each other. Use names that differ by more than case if
+   the collection may live on one. */
+
+/** Most filesystems allow at most 255 bytes in a file name. An encoded name
+    gets a suffix such as "_labels", and a record is written through a temporary
+    file named ".<name>.timer.tmp" plus up to ten random digits, so some room is
+    left for those. */
+const MAX_ENCODED_NAME_LENGTH int = 255 - 32
+
+var reservedNames map[string]bool = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func isSafeNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+/** Rejects names that are empty, contain NUL, or try to climb out of the
+    collection with a ".." path component. */
+func validateTimerName(name string) error {
+	if name == "" || strings.IndexByte(name, 0) != -1 {
+		return fmt.Errorf("invalid file timer name %q", name)
+	}
+	for _, part := range strings.FieldsFunc(name, func (r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("file timer name %q contains a path traversal", name)
+		}
+	}
+	return nil
+}
+
+/** A name that is too long once encoded is rejected here, rather than left to
+    fail with whatever error the OS gives for an over-long file name. */
+func encodeTimerName(name string) string {
+	if err := validateTimerName(name); err != nil {
+		panic(fmt.Sprintf("Attempted to use file timer: %v", err))
+	}
+	var encoded string = escapeTimerName(name)
+	if len(encoded) > MAX_ENCODED_NAME_LENGTH {
+		panic(fmt.Sprintf("Attempted to use file timer: name %q is %d bytes once encoded, more than the %d allowed",
+			name, len(encoded), MAX_ENCODED_NAME_LENGTH))
+	}
+	return encoded
+}
+
+func escapeTimerName(name string) string {
+	var base string = name
+	if i := strings.IndexByte(base, '.'); i != -1 {
+		base = base[:i]
+	}
+	var buf strings.Builder
+	for i := 0; i < len(name); i++ {
+		var c byte = name[i]
+		if isSafeNameByte(c) && !(i == 0 && (c == '.' || reservedNames[strings.ToUpper(base)])) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+/** Returns false if encoded could not have come from encodeTimerName. */
+func decodeTimerName(encoded string) (string, bool) {
+	var buf strings.Builder
+	for i := 0; i < len(encoded); i++ {
+		if encoded[i] != '%' {
+			if !isSafeNameByte(encoded[i]) {
+				return "", false
+			}
+			buf.WriteByte(encoded[i])
+			continue
+		}
+		if i + 2 >= len(encoded) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(encoded[i + 1:i + 3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		buf.WriteByte(byte(c))
+		i += 2
+	}
+	return buf.String(), buf.Len() != 0
+}
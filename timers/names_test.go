@@ -0,0 +1,102 @@
+package timers
+
+import "os"
+import "strings"
+import "testing"
+
+func TestTimerNames1(t *testing.T) {
+	var names []string = []string{"plain", "GET /users 200", "../../etc/passwd_", "a/b", ".hidden", "x_start", "100%", "con", "CON.log", "con2", "ünïcode"}
+	for _, name := range names {
+		var encoded string
+		func () {
+				defer func () {
+						if r := recover(); r != nil {
+							encoded = ""
+						}
+					}()
+				encoded = encodeTimerName(name)
+			}()
+		if name == "../../etc/passwd_" {
+			if encoded != "" {
+				t.Logf("Path traversal %q was accepted as %q", name, encoded)
+				t.Fail()
+			}
+			continue
+		}
+		decoded, ok := decodeTimerName(encoded)
+		if !ok || decoded != name {
+			t.Logf("%q encoded as %q decoded as %q", name, encoded, decoded)
+			t.Fail()
+		}
+		for i := 0; i < len(encoded); i++ {
+			if encoded[i] == '/' || encoded[i] == '\\' || encoded[i] == ' ' || i == 0 && encoded[i] == '.' {
+				t.Logf("%q encoded unsafely as %q", name, encoded)
+				t.Fail()
+			}
+		}
+	}
+	if encodeTimerName("plain") != "plain" || encodeTimerName("x_start") != "x_start" || encodeTimerName("con2") != "con2" {
+		t.Log("Safe names were changed")
+		t.Fail()
+	}
+}
+
+func TestTimerNames2(t *testing.T) {
+	os.MkdirAll("/home/sam/timers/names", 0755)
+	SetFileTimerCollection("/home/sam/timers/names")
+	defer SetFileTimerCollection("/home/sam/timers")
+	var names []string = []string{"GET /users", "x", "x_start", "..."}
+	for _, name := range names {
+		StartFileTimer(name)
+	}
+	EndFileTimer("x")
+	var infos []TimerInfo = ListFileTimers()
+	if len(infos) != len(names) {
+		t.Logf("Bad listing %v", infos)
+		t.Fail()
+	}
+	for _, name := range names {
+		if findInfo(infos, name) == nil {
+			t.Logf("Timer %q missing from listing %v", name, infos)
+			t.Fail()
+		}
+	}
+	if GetFileTimerDelta("x") < 0 || GetFileTimerDelta("x_start") != -2 {
+		t.Log("Timers x and x_start collided")
+		t.Fail()
+	}
+	for _, name := range names {
+		DeleteFileTimer(name)
+	}
+	if _, err := os.Stat("/home/sam/timers/users"); err == nil {
+		t.Log("Timer escaped its collection")
+		t.Fail()
+	}
+}
+
+func TestTimerNames3(t *testing.T) {
+	var long string = strings.Repeat("x", MAX_ENCODED_NAME_LENGTH)
+	var names []string = []string{long + "x", strings.Repeat(" ", MAX_ENCODED_NAME_LENGTH / 3 + 1)}
+	for _, name := range names {
+		var msg string
+		func () {
+				defer func () {
+						if r := recover(); r != nil {
+							msg, _ = r.(string)
+						}
+					}()
+				StartFileTimer(name)
+			}()
+		if !strings.Contains(msg, "once encoded") {
+			t.Logf("Over-long name of %d bytes gave %q", len(name), msg)
+			t.Fail()
+		}
+	}
+	StartFileTimer(long)
+	EndFileTimer(long)
+	if GetFileTimerDelta(long) < 0 {
+		t.Log("Longest allowed name was not usable")
+		t.Fail()
+	}
+	DeleteFileTimer(long)
+}
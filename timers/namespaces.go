@@ -0,0 +1,118 @@
+package timers
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	)
+
+/* FILE TIMER NAMESPACES
+   A namespace is a subdirectory of the collection, e.g. "job42/run7", so that
+   separate jobs or runs can share a collection without their timer names
+   colliding, and can be cleaned up or exported as a unit. Each component of a
+   namespace is encoded like a timer name. */
+
+func namespaceDir(namespace string) string {
+	var dir string = timerRoot
+	for _, part := range strings.Split(namespace, "/") {
+		if part != "" {
+			dir = dir + "/" + encodeTimerName(part)
+		}
+	}
+	return dir
+}
+
+/** Timers started after this live in the given namespace of the current
+    collection, which is created if needed. "" is the collection's root. */
+func SetFileTimerNamespace(namespace string) {
+	if timerRoot == "" {
+		panic(fmt.Sprintf("Attempted to set namespace %s without a Timer collection", namespace))
+	}
+	var dir string = namespaceDir(namespace)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create timer namespace %s: %v", namespace, err))
+	}
+	timerDir = dir
+	timerNamespace = strings.Trim(namespace, "/")
+}
+
+func GetFileTimerNamespace() string {
+	return timerNamespace
+}
+
+/** Lists the namespaces directly inside the current one. */
+func ListFileTimerNamespaces() []string {
+	_, namespaces, err := scanFileTimerDir(timerDir)
+	if err != nil {
+		panic(fmt.Sprintf("Could not list namespaces in %s: %v", timerDir, err))
+	}
+	if namespaces == nil {
+		namespaces = make([]string, 0)
+	}
+	return namespaces
+}
+
+/** Deletes a namespace, relative to the collection's root, with all of its
+    timers and nested namespaces. If it is the current namespace, the current
+    namespace goes back to the root. */
+func DeleteFileTimerNamespace(namespace string) {
+	var dir string = namespaceDir(namespace)
+	if dir == timerRoot {
+		panic("Attempted to delete the root namespace of a Timer collection")
+	}
+	defer lockFileCollection()()
+	err := os.RemoveAll(dir)
+	if err != nil {
+		panic(fmt.Sprintf("Could not delete timer namespace %s: %v", namespace, err))
+	}
+	if timerDir == dir || strings.HasPrefix(timerDir, dir + "/") {
+		timerDir = timerRoot
+		timerNamespace = ""
+	}
+}
+
+/** Writes a namespace, relative to the collection's root, and everything in it
+    as a tar archive. Paths in the archive are relative to the namespace and
+    keep the encoded file names, so extracting it into a directory gives a
+    collection with the same timers. */
+func ExportFileTimerNamespace(namespace string, writer io.Writer) error {
+	var dir string = namespaceDir(namespace)
+	defer lockFileCollection()()
+	var archive *tar.Writer = tar.NewWriter(writer)
+	err := filepath.Walk(dir, func (path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir || strings.HasPrefix(info.Name(), ".") {
+				return nil // skip the lock and any temporary files
+			}
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			header.Name = filepath.ToSlash(rel)
+			if info.IsDir() {
+				header.Name += "/"
+			}
+			err = archive.WriteHeader(header)
+			if err != nil || info.IsDir() {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(archive, f)
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
@@ -0,0 +1,72 @@
+package timers
+
+import "archive/tar"
+import "bytes"
+import "io"
+import "os"
+import "testing"
+
+func TestNamespaces1(t *testing.T) {
+	defer SetFileTimerCollection("/home/sam/timers")
+	os.RemoveAll("/home/sam/timers/auto")
+	SetFileTimerAutoCreate(true)
+	SetFileTimerCollection("/home/sam/timers/auto/collection")
+	SetFileTimerAutoCreate(false)
+	StartFileTimer("t1")
+	SetFileTimerNamespace("job42/run7")
+	StartFileTimer("t1")
+	EndFileTimer("t1")
+	SetFileTimerNamespace("job42/run 8")
+	StartFileTimer("t1")
+	if GetFileTimerDelta("t1") != -2 {
+		t.Log("Timers in different namespaces collided")
+		t.Fail()
+	}
+	SetFileTimerNamespace("job42")
+	var namespaces []string = ListFileTimerNamespaces()
+	if len(namespaces) != 2 || namespaces[0] != "run 8" || namespaces[1] != "run7" || len(ListFileTimers()) != 0 {
+		t.Logf("Bad namespaces %v", namespaces)
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	if err := ExportFileTimerNamespace("job42", &buf); err != nil {
+		t.Logf("Export failed: %v", err)
+		t.Fail()
+	}
+	var files map[string]bool = make(map[string]bool)
+	var archive *tar.Reader = tar.NewReader(&buf)
+	for header, err := archive.Next(); err != io.EOF; header, err = archive.Next() {
+		if err != nil {
+			t.Logf("Bad archive: %v", err)
+			t.Fail()
+			break
+		}
+		files[header.Name] = true
+	}
+	if len(files) != 4 || !files["run7/t1.timer"] || !files["run%208/t1.timer"] {
+		t.Logf("Bad archive contents %v", files)
+		t.Fail()
+	}
+	DeleteFileTimerNamespace("job42")
+	if GetFileTimerNamespace() != "" || len(ListFileTimerNamespaces()) != 0 || len(ListFileTimers()) != 1 {
+		t.Log("Namespace was not deleted")
+		t.Fail()
+	}
+	DeleteFileTimer("t1")
+}
+
+func TestNamespaces2(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			SetFileTimerCollection("/home/sam/timers")
+		}()
+	SetFileTimerCollection("/home/sam/timers")
+	SetFileTimerNamespace("ok/fine")
+	SetFileTimerNamespace("")
+	finished = true
+	SetFileTimerNamespace("ok/../..")
+}
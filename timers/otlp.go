@@ -0,0 +1,310 @@
+package timers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	)
+
+/* OTLP SPAN EXPORT
+   Converts intervals into OpenTelemetry spans and encodes them as an OTLP
+   ExportTraceServiceRequest, either as JSON or as protobuf. The protobuf is
+   written by hand, so there is no dependency on the OpenTelemetry libraries.
+   Every span from one export shares a trace ID. */
+
+const (
+	OTLP_JSON int = iota
+	OTLP_PROTOBUF
+	)
+
+const (
+	OTLP_CONTENT_TYPE_JSON string = "application/json"
+	OTLP_CONTENT_TYPE_PROTOBUF string = "application/x-protobuf"
+	OTLP_SCOPE_NAME string = "go-timers"
+	)
+
+/* Values of the OTLP Span.SpanKind and Status.StatusCode enums. */
+const (
+	otlpSpanKindInternal int = 1
+	otlpStatusUnset int = 0
+	otlpStatusOK int = 1
+	otlpStatusError int = 2
+	)
+
+/** Receives encoded payloads, in place of an OTLP collector. */
+type SpanSink interface {
+	ExportSpans(payload []byte, contentType string) error
+}
+
+/** Keeps every payload in memory. */
+type MemorySpanSink struct {
+	lock sync.Mutex
+	payloads [][]byte
+}
+
+func (sink *MemorySpanSink) ExportSpans(payload []byte, contentType string) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.payloads = append(sink.payloads, append([]byte(nil), payload...))
+	return nil
+}
+
+func (sink *MemorySpanSink) Payloads() [][]byte {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return append([][]byte(nil), sink.payloads...)
+}
+
+/** Appends each payload to a file. JSON payloads are written one per line;
+    protobuf payloads are each preceded by their length as a uint32 LE. */
+type FileSpanSink struct {
+	Path string
+}
+
+func (sink *FileSpanSink) ExportSpans(payload []byte, contentType string) error {
+	f, err := os.OpenFile(sink.Path, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if contentType == OTLP_CONTENT_TYPE_PROTOBUF {
+		err = binary.Write(f, binary.LittleEndian, uint32(len(payload)))
+		if err == nil {
+			_, err = f.Write(payload)
+		}
+	} else {
+		_, err = f.Write(append(payload, '\n'))
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type SpanExporter struct {
+	ServiceName string // the service.name resource attribute
+	Format int // OTLP_JSON or OTLP_PROTOBUF
+	Sink SpanSink
+}
+
+/** Exports every completed interval in tmap as one payload. */
+func (exporter *SpanExporter) Export(tmap map[string]*TimerSummary) error {
+	return exporter.ExportIntervals(ParseMapToIntervals(tmap))
+}
+
+/** Exports the intervals in the given log files. */
+func (exporter *SpanExporter) ExportFiles(filenames []string) error {
+	return exporter.Export(ParseFileToMap(filenames))
+}
+
+func (exporter *SpanExporter) ExportIntervals(intervals []Interval) error {
+	if exporter.Format == OTLP_PROTOBUF {
+		return exporter.Sink.ExportSpans(EncodeSpansProtobuf(exporter.ServiceName, intervals), OTLP_CONTENT_TYPE_PROTOBUF)
+	}
+	return exporter.Sink.ExportSpans(EncodeSpansJSON(exporter.ServiceName, intervals), OTLP_CONTENT_TYPE_JSON)
+}
+
+type otlpSpan struct {
+	traceID []byte
+	spanID []byte
+	name string
+	start int64
+	end int64
+	attributes [][2]string
+	status int
+	message string
+}
+
+func makeSpans(intervals []Interval) []otlpSpan {
+	var traceID []byte = make([]byte, 16)
+	rand.Read(traceID)
+	var spans []otlpSpan = make([]otlpSpan, len(intervals))
+	for i, interval := range intervals {
+		var id uint64 = interval.ID
+		if id == 0 {
+			id = nextInstanceID()
+		}
+		var span *otlpSpan = &spans[i]
+		span.traceID = traceID
+		span.spanID = make([]byte, 8)
+		binary.BigEndian.PutUint64(span.spanID, id)
+		span.name = interval.Name
+		span.start, span.end = interval.Start, interval.End
+		for _, k := range interval.Labels.sortedKeys() {
+			span.attributes = append(span.attributes, [2]string{k, interval.Labels[k]})
+		}
+		if interval.Outcome != OUTCOME_NONE {
+			span.attributes = append(span.attributes, [2]string{"timer.outcome", interval.Outcome.String()})
+		}
+		switch interval.Outcome {
+		case OUTCOME_SUCCESS:
+			span.status = otlpStatusOK
+		case OUTCOME_ERROR, OUTCOME_PANIC:
+			span.status = otlpStatusError
+			span.message = interval.Outcome.String()
+		default:
+			span.status = otlpStatusUnset
+		}
+	}
+	return spans
+}
+
+/* The JSON encoding follows the OTLP/HTTP JSON mapping: IDs are hex, 64-bit
+   integers are strings, and enums are numbers. */
+
+type otlpJSONKeyValue struct {
+	Key string `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpJSONStatus struct {
+	Code int `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpJSONSpan struct {
+	TraceID string `json:"traceId"`
+	SpanID string `json:"spanId"`
+	Name string `json:"name"`
+	Kind int `json:"kind"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	EndTimeUnixNano string `json:"endTimeUnixNano"`
+	Attributes []otlpJSONKeyValue `json:"attributes,omitempty"`
+	Status otlpJSONStatus `json:"status"`
+}
+
+func otlpJSONAttributes(pairs [][2]string) []otlpJSONKeyValue {
+	var kvs []otlpJSONKeyValue = make([]otlpJSONKeyValue, len(pairs))
+	for i, pair := range pairs {
+		kvs[i] = otlpJSONKeyValue{pair[0], map[string]string{"stringValue": pair[1]}}
+	}
+	return kvs
+}
+
+func EncodeSpansJSON(serviceName string, intervals []Interval) []byte {
+	var spans []otlpJSONSpan = make([]otlpJSONSpan, 0, len(intervals))
+	for _, span := range makeSpans(intervals) {
+		spans = append(spans, otlpJSONSpan{
+			TraceID: hex.EncodeToString(span.traceID),
+			SpanID: hex.EncodeToString(span.spanID),
+			Name: span.name,
+			Kind: otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.start, 10),
+			EndTimeUnixNano: strconv.FormatInt(span.end, 10),
+			Attributes: otlpJSONAttributes(span.attributes),
+			Status: otlpJSONStatus{span.status, span.message},
+		})
+	}
+	var request map[string]interface{} = map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpJSONAttributes([][2]string{{"service.name", serviceName}}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": OTLP_SCOPE_NAME},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+/* The protobuf encoding writes just the fields of the OTLP messages that are
+   used here. Field numbers are from opentelemetry/proto/trace/v1/trace.proto
+   and opentelemetry/proto/common/v1/common.proto. */
+
+const (
+	protoVarint int = 0
+	protoFixed64 int = 1
+	protoBytes int = 2
+	)
+
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (buf *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	buf.WriteByte(byte(v))
+}
+
+func (buf *protoBuffer) tag(field int, wiretype int) {
+	buf.varint(uint64(field << 3 | wiretype))
+}
+
+func (buf *protoBuffer) bytesField(field int, data []byte) {
+	buf.tag(field, protoBytes)
+	buf.varint(uint64(len(data)))
+	buf.Write(data)
+}
+
+func (buf *protoBuffer) stringField(field int, s string) {
+	if s != "" {
+		buf.bytesField(field, []byte(s))
+	}
+}
+
+func (buf *protoBuffer) varintField(field int, v uint64) {
+	if v != 0 {
+		buf.tag(field, protoVarint)
+		buf.varint(v)
+	}
+}
+
+func (buf *protoBuffer) fixed64Field(field int, v uint64) {
+	buf.tag(field, protoFixed64)
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], v)
+	buf.Write(data[:])
+}
+
+func protoKeyValue(key string, value string) []byte {
+	var anyValue, kv protoBuffer
+	anyValue.stringField(1, value) // AnyValue.string_value
+	kv.stringField(1, key) // KeyValue.key
+	kv.bytesField(2, anyValue.Bytes()) // KeyValue.value
+	return kv.Bytes()
+}
+
+func protoSpan(span otlpSpan) []byte {
+	var buf, status protoBuffer
+	buf.bytesField(1, span.traceID)
+	buf.bytesField(2, span.spanID)
+	buf.stringField(5, span.name)
+	buf.varintField(6, uint64(otlpSpanKindInternal))
+	buf.fixed64Field(7, uint64(span.start))
+	buf.fixed64Field(8, uint64(span.end))
+	for _, pair := range span.attributes {
+		buf.bytesField(9, protoKeyValue(pair[0], pair[1]))
+	}
+	status.stringField(2, span.message) // Status.message
+	status.varintField(3, uint64(span.status)) // Status.code
+	buf.bytesField(15, status.Bytes())
+	return buf.Bytes()
+}
+
+func EncodeSpansProtobuf(serviceName string, intervals []Interval) []byte {
+	var resource, scope, scopeSpans, resourceSpans, request protoBuffer
+	resource.bytesField(1, protoKeyValue("service.name", serviceName)) // Resource.attributes
+	scope.stringField(1, OTLP_SCOPE_NAME) // InstrumentationScope.name
+	scopeSpans.bytesField(1, scope.Bytes()) // ScopeSpans.scope
+	for _, span := range makeSpans(intervals) {
+		scopeSpans.bytesField(2, protoSpan(span)) // ScopeSpans.spans
+	}
+	resourceSpans.bytesField(1, resource.Bytes()) // ResourceSpans.resource
+	resourceSpans.bytesField(2, scopeSpans.Bytes()) // ResourceSpans.scope_spans
+	request.bytesField(1, resourceSpans.Bytes()) // ExportTraceServiceRequest.resource_spans
+	return request.Bytes()
+}
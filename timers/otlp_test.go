@@ -0,0 +1,116 @@
+package timers
+
+import "encoding/binary"
+import "encoding/json"
+import "io/ioutil"
+import "os"
+import "testing"
+
+type otlpTestRequest struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []otlpJSONSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestOTLP1(t *testing.T) {
+	defer ResetLogBuffer()
+	var h1 *Handle = StartBufferedLogHandle("request")
+	var h2 *Handle = StartBufferedLogHandle("request")
+	h1.AddLabels(Labels{"endpoint": "/users"})
+	h1.EndWithOutcome(OUTCOME_SUCCESS)
+	h2.EndWithOutcome(OUTCOME_ERROR)
+	var sink *MemorySpanSink = &MemorySpanSink{}
+	var exporter *SpanExporter = &SpanExporter{ServiceName: "svc", Sink: sink}
+	if err := exporter.Export(GetLogBuffer()); err != nil {
+		t.Logf("Export failed: %v", err)
+		t.Fail()
+	}
+	var request otlpTestRequest
+	if len(sink.Payloads()) != 1 || json.Unmarshal(sink.Payloads()[0], &request) != nil {
+		t.Log("Bad payload")
+		t.Fail()
+		return
+	}
+	var spans []otlpJSONSpan = request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].TraceID != spans[1].TraceID || spans[0].SpanID == spans[1].SpanID {
+		t.Logf("Bad spans %v", spans)
+		t.Fail()
+		return
+	}
+	if spans[0].Status.Code != otlpStatusOK || spans[1].Status.Code != otlpStatusError || len(spans[0].Attributes) != 2 || spans[0].Attributes[0].Value["stringValue"] != "/users" {
+		t.Logf("Bad span details %v", spans)
+		t.Fail()
+	}
+}
+
+/** Reads the top-level fields of a protobuf message into a map of field number
+    to raw values, which is enough to walk the nesting. */
+func readProto(t *testing.T, data []byte) map[int][][]byte {
+	var fields map[int][][]byte = make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		switch int(key & 7) {
+		case protoVarint:
+			_, n = binary.Uvarint(data)
+			fields[int(key >> 3)] = append(fields[int(key >> 3)], data[:n])
+			data = data[n:]
+		case protoFixed64:
+			fields[int(key >> 3)] = append(fields[int(key >> 3)], data[:8])
+			data = data[8:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			fields[int(key >> 3)] = append(fields[int(key >> 3)], data[n:n + int(length)])
+			data = data[n + int(length):]
+		default:
+			t.Logf("Unexpected wire type in key %d", key)
+			t.Fail()
+			return fields
+		}
+	}
+	return fields
+}
+
+func TestOTLP2(t *testing.T) {
+	os.Remove("/home/sam/timers/spans")
+	var intervals []Interval = []Interval{
+		Interval{Name: "a", Start: 100, End: 300},
+		Interval{Name: "b", ID: 9, Start: 150, End: 200, Outcome: OUTCOME_PANIC, Labels: Labels{"k": "v"}},
+	}
+	var exporter *SpanExporter = &SpanExporter{"svc", OTLP_PROTOBUF, &FileSpanSink{"/home/sam/timers/spans"}}
+	exporter.ExportIntervals(intervals)
+	exporter.ExportIntervals(intervals[:1])
+	var data []byte
+	data, _ = ioutil.ReadFile("/home/sam/timers/spans")
+	var length uint32 = binary.LittleEndian.Uint32(data)
+	var payload []byte = data[4:4 + length]
+	if len(data) != 8 + int(length) + int(binary.LittleEndian.Uint32(data[4 + length:])) {
+		t.Log("Payloads were not framed")
+		t.Fail()
+		return
+	}
+	var resourceSpans map[int][][]byte = readProto(t, readProto(t, payload)[1][0])
+	var resource map[int][][]byte = readProto(t, readProto(t, resourceSpans[1][0])[1][0])
+	if string(resource[1][0]) != "service.name" {
+		t.Log("Bad resource")
+		t.Fail()
+	}
+	var spans [][]byte = readProto(t, resourceSpans[2][0])[2]
+	if len(spans) != 2 {
+		t.Logf("Got %d spans", len(spans))
+		t.Fail()
+		return
+	}
+	var span map[int][][]byte = readProto(t, spans[1])
+	if string(span[5][0]) != "b" || binary.BigEndian.Uint64(span[2][0]) != 9 || binary.LittleEndian.Uint64(span[8][0]) != 200 || len(span[9]) != 2 {
+		t.Log("Bad span fields")
+		t.Fail()
+	}
+	var status map[int][][]byte = readProto(t, span[15][0])
+	if string(status[2][0]) != "panic" || status[3][0][0] != byte(otlpStatusError) {
+		t.Logf("Bad status %v", status)
+		t.Fail()
+	}
+}
@@ -0,0 +1,73 @@
+package timers
+
+import "testing"
+import "time"
+
+func TestPauseTimers1(t *testing.T) {
+	StartTimer("t1")
+	time.Sleep(2 * time.Millisecond)
+	PauseTimer("t1")
+	time.Sleep(20 * time.Millisecond)
+	var paused int64 = PollTimer("t1")
+	time.Sleep(5 * time.Millisecond)
+	if PollTimer("t1") != paused {
+		t.Log("Paused timer kept running")
+		t.Fail()
+	}
+	ResumeTimer("t1")
+	time.Sleep(2 * time.Millisecond)
+	PauseTimer("t1")
+	time.Sleep(20 * time.Millisecond)
+	ResumeTimer("t1")
+	EndTimer("t1")
+	var active int64 = GetTimerDelta("t1")
+	var elapsed int64 = GetTimerElapsed("t1")
+	if active < int64(4 * time.Millisecond) || elapsed - active < int64(45 * time.Millisecond) {
+		t.Logf("Bad active time %v for elapsed time %v", active, elapsed)
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	StartTimer("t1")
+	if PollTimerElapsed("t1") - PollTimer("t1") > int64(time.Millisecond) {
+		t.Log("Pauses survived DeleteTimer")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+}
+
+func TestPauseTimers2(t *testing.T) {
+	StartTimer("t1")
+	PauseTimer("t1")
+	time.Sleep(10 * time.Millisecond)
+	EndTimer("t1")
+	if GetTimerDelta("t1") > int64(5 * time.Millisecond) {
+		t.Log("Ending a paused timer counted the pause")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	StartTimer("t1")
+	PauseTimer("t1")
+	time.Sleep(10 * time.Millisecond)
+	if ResetTimer("t1") > int64(5 * time.Millisecond) {
+		t.Log("ResetTimer counted the pause")
+		t.Fail()
+	}
+	ResumeTimer("t1")
+	DeleteTimer("t1")
+}
+
+func TestPauseTimers3(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteTimer("t1")
+		}()
+	StartTimer("t1")
+	PauseTimer("t1")
+	ResumeTimer("t1")
+	finished = true
+	ResumeTimer("t1")
+}
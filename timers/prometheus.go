@@ -0,0 +1,168 @@
+package timers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	)
+
+/* PROMETHEUS EXPOSITION
+   Serves the buffered log as one summary per timer and label set, along with
+   the number of running hashtable timers, in the Prometheus text format.
+   Durations are in seconds, as Prometheus expects. */
+
+const PROMETHEUS_CONTENT_TYPE string = "text/plain; version=0.0.4; charset=utf-8"
+
+var PROMETHEUS_QUANTILES []float64 = []float64{0.5, 0.9, 0.99}
+
+type promSeries struct {
+	name string
+	labels Labels
+	deltas []int64
+}
+
+/** Metric names are prefixed with prefix, e.g. "myservice_timers". */
+func PrometheusHandler(prefix string) http.Handler {
+	prefix = sanitizePromName(prefix)
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writePrometheus(&buf, prefix)
+		w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+		w.Write(buf.Bytes())
+	})
+}
+
+func writePrometheus(writer io.Writer, prefix string) {
+	var metric string = prefix + "_duration_seconds"
+	fmt.Fprintf(writer, "# HELP %s Durations of the completed timers in the buffered log.\n", metric)
+	fmt.Fprintf(writer, "# TYPE %s summary\n", metric)
+	for _, series := range bufferedSeries() {
+		var sorted []int64 = append([]int64(nil), series.deltas...)
+		sort.Slice(sorted, func (i int, j int) bool { return sorted[i] < sorted[j] })
+		var sum int64 = 0
+		for _, delta := range sorted {
+			sum += delta
+		}
+		var labels string = promLabels(series.name, series.labels)
+		for _, q := range PROMETHEUS_QUANTILES {
+			fmt.Fprintf(writer, "%s{%s,quantile=\"%s\"} %s\n", metric, labels, promFloat(q), promSeconds(quantile(sorted, q)))
+		}
+		fmt.Fprintf(writer, "%s_sum{%s} %s\n", metric, labels, promSeconds(sum))
+		fmt.Fprintf(writer, "%s_count{%s} %d\n", metric, labels, len(sorted))
+	}
+
+	var counts map[string]int = map[string]int{STATE_RUNNING: 0, STATE_PAUSED: 0}
+	for _, info := range ListTimers() {
+		if _, ok := counts[info.State]; ok {
+			counts[info.State]++
+		}
+	}
+	metric = prefix + "_running_timers"
+	fmt.Fprintf(writer, "# HELP %s Hashtable timers that have been started but not ended.\n", metric)
+	fmt.Fprintf(writer, "# TYPE %s gauge\n", metric)
+	fmt.Fprintf(writer, "%s{state=\"%s\"} %d\n", metric, STATE_RUNNING, counts[STATE_RUNNING])
+	fmt.Fprintf(writer, "%s{state=\"%s\"} %d\n", metric, STATE_PAUSED, counts[STATE_PAUSED])
+}
+
+/** Collects the deltas in the buffered log, grouped by timer and label set.
+    Unlike ParseMapToDeltas this is quiet about timers that are still running,
+    since a scrape will almost always catch some. */
+func bufferedSeries() []*promSeries {
+	bufferLock.Lock()
+	defer bufferLock.Unlock()
+	var groups map[string]*promSeries = make(map[string]*promSeries)
+	var add = func (name string, labels Labels, delta int64) {
+		var key string = groupKey(name, labels, labels.sortedKeys())
+		series, ok := groups[key]
+		if !ok {
+			series = &promSeries{name: name, labels: labels}
+			groups[key] = series
+		}
+		series.deltas = append(series.deltas, delta)
+	}
+	for name, summary := range bufferedTimers {
+		settledDeltas(summary, func (labels Labels, delta int64) {
+			add(name, labels, delta)
+		})
+	}
+	var keys []string = make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var result []*promSeries = make([]*promSeries, len(keys))
+	for i, key := range keys {
+		result[i] = groups[key]
+	}
+	return result
+}
+
+/** Calls settled with each completed delta in summary. Starts and ends without
+    an instance ID are paired as ParseMapToDeltas pairs them, apart from a
+    trailing start, which is taken to be a run in progress; if they can't be
+    paired they are quietly skipped. */
+func settledDeltas(summary *TimerSummary, settled func(labels Labels, delta int64)) {
+	var starts []int64 = summary.starts
+	if n := len(summary.ends); len(starts) == n + 1 && (n == 0 || starts[n] >= summary.ends[n - 1]) {
+		starts = starts[:n]
+	}
+	for _, delta := range pairPositional("", &TimerSummary{starts, summary.ends, nil}, func (Anomaly) {}) {
+		settled(nil, delta)
+	}
+	for _, inst := range summary.instances {
+		if inst.started && inst.ended && inst.end >= inst.start {
+			settled(inst.labels, inst.end - inst.start)
+		}
+	}
+}
+
+/** The timer name goes in a "timer" label, since names needn't be valid metric
+    names. Label keys that clash with it or with "quantile" are prefixed, and
+    keys that sanitize to the same name, such as a-b and a_b, get a numbered
+    suffix in sorted key order. */
+func promLabels(name string, labels Labels) string {
+	var parts []string = []string{fmt.Sprintf("timer=\"%s\"", escapePromValue(name))}
+	var used map[string]bool = map[string]bool{"timer": true, "quantile": true}
+	for _, k := range labels.sortedKeys() {
+		var key string = sanitizePromName(k)
+		if key == "timer" || key == "quantile" || strings.HasPrefix(key, "__") {
+			key = "label_" + key
+		}
+		var unique string = key
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s_%d", key, i)
+		}
+		used[unique] = true
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", unique, escapePromValue(labels[k])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func sanitizePromName(name string) string {
+	var buf []byte = []byte(name)
+	for i, c := range buf {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			buf[i] = '_'
+		}
+	}
+	if len(buf) == 0 {
+		return "_"
+	}
+	return string(buf)
+}
+
+func escapePromValue(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func promSeconds(nanos int64) string {
+	return promFloat(float64(nanos) / 1e9)
+}
+
+func promFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package timers
+
+import "net/http/httptest"
+import "strings"
+import "testing"
+
+func TestPrometheus1(t *testing.T) {
+	defer ResetLogBuffer()
+	defer DeleteTimer("promrunning")
+	StartBufferedLogTimer("legacy")
+	EndBufferedLogTimer("legacy")
+	StartBufferedLogTimer("legacy")
+	StartBufferedLogTimer("overlap")
+	StartBufferedLogTimer("overlap")
+	EndBufferedLogTimer("overlap")
+	EndBufferedLogTimer("overlap")
+	var h1 *Handle = StartBufferedLogHandle("request")
+	var h2 *Handle = StartBufferedLogHandle("request")
+	h1.EndWithLabels(Labels{"endpoint": "/users", "quantile": "x\"y"})
+	h2.End()
+	StartBufferedLogHandle("request")
+	StartTimer("promrunning")
+
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	PrometheusHandler("svc_timers").ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != 200 || recorder.Header().Get("Content-Type") != PROMETHEUS_CONTENT_TYPE {
+		t.Logf("Bad response %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+		t.Fail()
+	}
+	var body string = recorder.Body.String()
+	var expected []string = []string{
+		"# TYPE svc_timers_duration_seconds summary\n",
+		"svc_timers_duration_seconds_count{timer=\"legacy\"} 1\n",
+		"svc_timers_duration_seconds_count{timer=\"request\"} 1\n",
+		"svc_timers_duration_seconds_count{timer=\"request\",endpoint=\"/users\",label_quantile=\"x\\\"y\"} 1\n",
+		"svc_timers_duration_seconds{timer=\"request\",quantile=\"0.99\"} ",
+		"# TYPE svc_timers_running_timers gauge\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Logf("Missing %q in\n%s", line, body)
+			t.Fail()
+		}
+	}
+	if strings.Contains(body, "timer=\"overlap\"") {
+		t.Log("Overlapping timers were paired")
+		t.Fail()
+	}
+	if strings.Contains(body, "svc_timers_running_timers{state=\"running\"} 0") {
+		t.Log("Running hashtable timer was not counted")
+		t.Fail()
+	}
+}
+
+func TestPrometheus2(t *testing.T) {
+	var sorted []int64 = []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if quantile(sorted, 0.5) != 5 || quantile(sorted, 0.9) != 9 || quantile(sorted, 0.99) != 10 || quantile(sorted, 0) != 1 {
+		t.Log("Quantiles computed incorrectly")
+		t.Fail()
+	}
+	if sanitizePromName("9 lives") != "__lives" || sanitizePromName("ok_name1") != "ok_name1" {
+		t.Log("Names sanitized incorrectly")
+		t.Fail()
+	}
+	if labels := promLabels("t", Labels{"a-b": "1", "a_b": "2", "a.b": "3", "timer": "4"}); labels != `timer="t",a_b="1",a_b_2="3",a_b_3="2",label_timer="4"` {
+		t.Logf("Clashing label keys not told apart: %s", labels)
+		t.Fail()
+	}
+}
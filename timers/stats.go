@@ -0,0 +1,75 @@
+package timers
+
+import (
+	"math"
+	"sort"
+	)
+
+/* STATISTICS
+   Summaries of the deltas produced by ParseMapToDeltas, and a way to collect
+   the anomalies that parsing would otherwise only print. */
+
+type DeltaStats struct {
+	Count int
+	Total int64
+	Min int64
+	Max int64
+	Mean float64
+	Stddev float64 // population standard deviation
+	P50 int64
+	P90 int64
+	P99 int64
+}
+
+/** Returns the zero DeltaStats if there are no deltas. Percentiles use the
+    nearest rank. */
+func SummarizeDeltas(deltas []int64) DeltaStats {
+	var stats DeltaStats
+	if len(deltas) == 0 {
+		return stats
+	}
+	var sorted []int64 = append([]int64(nil), deltas...)
+	sort.Slice(sorted, func (i int, j int) bool { return sorted[i] < sorted[j] })
+	stats.Count = len(sorted)
+	stats.Min, stats.Max = sorted[0], sorted[len(sorted) - 1]
+	for _, delta := range sorted {
+		stats.Total += delta
+	}
+	stats.Mean = float64(stats.Total) / float64(stats.Count)
+	var sumsq float64 = 0
+	for _, delta := range sorted {
+		sumsq += (float64(delta) - stats.Mean) * (float64(delta) - stats.Mean)
+	}
+	stats.Stddev = math.Sqrt(sumsq / float64(stats.Count))
+	stats.P50, stats.P90, stats.P99 = quantile(sorted, 0.5), quantile(sorted, 0.9), quantile(sorted, 0.99)
+	return stats
+}
+
+/** Nearest-rank quantile of sorted, which must not be empty. */
+func quantile(sorted []int64, q float64) int64 {
+	var rank int = int(math.Ceil(q * float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+/** Returns every anomaly ParseMapToDeltas would print, ordered by timer name
+    and then instance ID, without printing them. */
+func FindAnomalies(tmap map[string]*TimerSummary) []Anomaly {
+	var anomalies []Anomaly = make([]Anomaly, 0)
+	var report = func (a Anomaly) {
+		anomalies = append(anomalies, a)
+	}
+	for tname, tsummary := range tmap {
+		pairPositional(tname, tsummary, report)
+		pairInstances(tname, tsummary, report)
+	}
+	sort.Slice(anomalies, func (i int, j int) bool {
+		if anomalies[i].Name != anomalies[j].Name {
+			return anomalies[i].Name < anomalies[j].Name
+		}
+		return anomalies[i].ID < anomalies[j].ID
+	})
+	return anomalies
+}
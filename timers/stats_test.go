@@ -0,0 +1,57 @@
+package timers
+
+import "testing"
+
+func TestStats1(t *testing.T) {
+	var stats DeltaStats = SummarizeDeltas([]int64{4, 2, 8, 6})
+	if stats.Count != 4 || stats.Total != 20 || stats.Min != 2 || stats.Max != 8 || stats.Mean != 5 || stats.P50 != 4 || stats.P99 != 8 {
+		t.Logf("Bad stats %+v", stats)
+		t.Fail()
+	}
+	if stats.Stddev < 2.236 || stats.Stddev > 2.237 {
+		t.Logf("Bad standard deviation %v", stats.Stddev)
+		t.Fail()
+	}
+	if SummarizeDeltas(nil) != (DeltaStats{}) {
+		t.Log("Empty deltas gave nonzero stats")
+		t.Fail()
+	}
+}
+
+func TestStats2(t *testing.T) {
+	var tmap map[string]*TimerSummary = map[string]*TimerSummary{
+		"fine": &TimerSummary{[]int64{1}, []int64{2}, nil},
+		"unended": &TimerSummary{[]int64{1, 3}, []int64{2}, nil},
+		"request": &TimerSummary{instances: map[uint64]*timerInstance{
+			9: &timerInstance{start: 5, started: true},
+			3: &timerInstance{end: 5, ended: true},
+			4: &timerInstance{start: 1, end: 2, started: true, ended: true},
+		}},
+	}
+	var anomalies []Anomaly = FindAnomalies(tmap)
+	if len(anomalies) != 3 || anomalies[0].ID != 3 || anomalies[1].ID != 9 || anomalies[2].Name != "unended" {
+		t.Logf("Bad anomalies %v", anomalies)
+		t.Fail()
+		return
+	}
+	if anomalies[0].String() != "Timer request instance 3 was ended but never started" ||
+		anomalies[2].String() != "Timer unended has a different number of starts than ends" {
+		t.Logf("Bad messages %v", anomalies)
+		t.Fail()
+	}
+}
+
+func TestStats3(t *testing.T) {
+	defer SetAnomalyReporter(printAnomaly)
+	var reported []Anomaly
+	SetAnomalyReporter(func (a Anomaly) { reported = append(reported, a) })
+	var tmap map[string]*TimerSummary = map[string]*TimerSummary{
+		"unended": &TimerSummary{[]int64{1, 3}, []int64{2}, nil},
+	}
+	if len(ParseMapToDeltas(tmap)) != 0 || len(reported) != 1 || reported[0].Name != "unended" {
+		t.Logf("Anomalies not sent to the reporter: %v", reported)
+		t.Fail()
+	}
+	SetAnomalyReporter(nil)
+	ParseMapToDeltas(tmap)
+}
@@ -0,0 +1,319 @@
+package timers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	)
+
+/* CSV AND JSON LINES
+   Flattens logs into rows for tools that don't read the binary format: one row
+   per record as an Event, or one row per completed Interval. JSON Lines written
+   here can be imported back into the binary log format. Instance IDs are
+   written as strings, since they don't fit in a double. */
+
+const (
+	EVENT_START string = "start"
+	EVENT_END string = "end"
+	EVENT_LABELS string = "labels"
+	EVENT_LAP string = "lap"
+	EVENT_HEADER string = "header" // the host and process that wrote the log
+	)
+
+type Event struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // one of the EVENT_* constants
+	Time int64 `json:"time"`
+	Source string `json:"source,omitempty"`
+	ID uint64 `json:"id,omitempty,string"` // 0 for StartLogTimer and EndLogTimer
+	Outcome string `json:"outcome,omitempty"` // end events only
+	Labels Labels `json:"labels,omitempty"` // labels events only
+	Lap string `json:"lap,omitempty"` // lap events only
+	Host string `json:"host,omitempty"` // header events only
+	PID int `json:"pid,omitempty"` // header events only
+}
+
+type intervalRow struct {
+	Name string `json:"name"`
+	Start int64 `json:"start"`
+	End int64 `json:"end"`
+	Duration int64 `json:"duration"`
+	Source string `json:"source,omitempty"`
+	ID uint64 `json:"id,omitempty,string"`
+	Outcome string `json:"outcome,omitempty"`
+	Labels Labels `json:"labels,omitempty"`
+	PID int `json:"pid,omitempty"`
+	Host string `json:"host,omitempty"`
+}
+
+var EVENT_CSV_HEADER []string = []string{"name", "kind", "time", "source", "id", "outcome", "labels", "lap", "host", "pid"}
+var INTERVAL_CSV_HEADER []string = []string{"name", "start", "end", "duration", "source", "id", "outcome", "labels", "pid", "host"}
+
+/** Returns every record in the files, in order, without pairing anything. */
+func ParseFileToEvents(filenames []string) []Event {
+	var events []Event = make([]Event, 0)
+	for _, fname := range filenames {
+		readLogFile(fname, func (rec *logRecord) {
+			events = append(events, recordToEvent(rec, fname))
+		})
+	}
+	return events
+}
+
+func recordToEvent(rec *logRecord, source string) Event {
+	var event Event = Event{Name: rec.name, Time: rec.time, Source: source, ID: rec.id}
+	switch rec.symbol {
+	case START_SYMBOL, START_INSTANCE_SYMBOL:
+		event.Kind = EVENT_START
+	case END_SYMBOL, END_INSTANCE_SYMBOL, END_OUTCOME_SYMBOL:
+		event.Kind = EVENT_END
+		if rec.outcome != OUTCOME_NONE {
+			event.Outcome = rec.outcome.String()
+		}
+	case LABEL_SYMBOL:
+		event.Kind = EVENT_LABELS
+		event.Labels = rec.labels
+	case LAP_SYMBOL:
+		event.Kind = EVENT_LAP
+		event.Lap = rec.lap
+	case HEADER_SYMBOL:
+		event.Kind = EVENT_HEADER
+		event.Name, event.Host, event.PID = "", rec.name, rec.pid
+	}
+	return event
+}
+
+/** The inverse of Outcome.String. */
+func parseOutcome(s string) (Outcome, bool) {
+	if s == "" {
+		return OUTCOME_NONE, true
+	}
+	for o := OUTCOME_NONE; o <= OUTCOME_STALE; o++ {
+		if o.String() == s {
+			return o, true
+		}
+	}
+	return OUTCOME_NONE, false
+}
+
+/** Formats labels for a CSV cell, e.g. endpoint=/users;status=200. */
+func labelsCell(labels Labels) string {
+	var parts []string = make([]string, 0, len(labels))
+	for _, k := range labels.sortedKeys() {
+		parts = append(parts, k + "=" + labels[k])
+	}
+	return strings.Join(parts, ";")
+}
+
+func idCell(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+func pidCell(pid int) string {
+	if pid == 0 {
+		return ""
+	}
+	return strconv.Itoa(pid)
+}
+
+func WriteEventsCSV(writer io.Writer, events []Event) error {
+	var w *csv.Writer = csv.NewWriter(writer)
+	w.Write(EVENT_CSV_HEADER)
+	for _, event := range events {
+		w.Write([]string{event.Name, event.Kind, strconv.FormatInt(event.Time, 10), event.Source,
+			idCell(event.ID), event.Outcome, labelsCell(event.Labels), event.Lap, event.Host, pidCell(event.PID)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func WriteEventsJSONLines(writer io.Writer, events []Event) error {
+	var encoder *json.Encoder = json.NewEncoder(writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newIntervalRow(interval Interval) intervalRow {
+	var row intervalRow = intervalRow{interval.Name, interval.Start, interval.End, interval.Delta(), interval.Source,
+		interval.ID, "", interval.Labels, interval.PID, interval.Host}
+	if interval.Outcome != OUTCOME_NONE {
+		row.Outcome = interval.Outcome.String()
+	}
+	if len(row.Labels) == 0 {
+		row.Labels = nil
+	}
+	return row
+}
+
+func WriteIntervalsCSV(writer io.Writer, intervals []Interval) error {
+	var w *csv.Writer = csv.NewWriter(writer)
+	w.Write(INTERVAL_CSV_HEADER)
+	for _, interval := range intervals {
+		var row intervalRow = newIntervalRow(interval)
+		w.Write([]string{row.Name, strconv.FormatInt(row.Start, 10), strconv.FormatInt(row.End, 10),
+			strconv.FormatInt(row.Duration, 10), row.Source, idCell(row.ID), row.Outcome, labelsCell(row.Labels), pidCell(row.PID), row.Host})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func WriteIntervalsJSONLines(writer io.Writer, intervals []Interval) error {
+	var encoder *json.Encoder = json.NewEncoder(writer)
+	for _, interval := range intervals {
+		if err := encoder.Encode(newIntervalRow(interval)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/** Lines written by WriteEventsJSONLines become one record each. Lines written
+    by WriteIntervalsJSONLines, which have no "kind", become a start, any labels
+    and an end. Blank lines are skipped. */
+func ImportJSONLines(reader io.Reader, writer io.Writer) error {
+	var scanner *bufio.Scanner = bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+	var lineno int = 0
+	for scanner.Scan() {
+		lineno++
+		var line []byte = scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var row struct {
+			Event
+			Start *int64 `json:"start"`
+			End *int64 `json:"end"`
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		var records []*logRecord
+		var err error
+		if row.Kind != "" {
+			records, err = eventRecords(row.Event)
+		} else if row.Start != nil && row.End != nil {
+			records, err = intervalRecords(row.Event, *row.Start, *row.End)
+		} else {
+			err = fmt.Errorf("neither an event nor an interval")
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		for _, rec := range records {
+			if _, err = writer.Write(rec.encode()); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func checkImportName(s string, what string) error {
+	if strings.IndexByte(s, 0) != -1 {
+		return fmt.Errorf("%s %q contains NUL", what, s)
+	}
+	return nil
+}
+
+func checkImportEvent(event Event) (Outcome, error) {
+	if event.Name == "" {
+		return OUTCOME_NONE, fmt.Errorf("missing timer name")
+	}
+	var err error = checkImportName(event.Name, "timer name")
+	if len(event.Labels) > MAX_LABELS {
+		err = fmt.Errorf("%d labels, more than %d", len(event.Labels), MAX_LABELS)
+	}
+	for k, v := range event.Labels {
+		if err == nil {
+			err = checkImportName(k, "label")
+		}
+		if err == nil {
+			err = checkImportName(v, "label value")
+		}
+	}
+	if err != nil {
+		return OUTCOME_NONE, err
+	}
+	outcome, ok := parseOutcome(event.Outcome)
+	if !ok {
+		return OUTCOME_NONE, fmt.Errorf("unknown outcome %q", event.Outcome)
+	}
+	return outcome, nil
+}
+
+func eventRecords(event Event) ([]*logRecord, error) {
+	if event.Kind == EVENT_HEADER {
+		if err := checkImportName(event.Host, "host"); err != nil {
+			return nil, err
+		}
+		return []*logRecord{&logRecord{name: event.Host, symbol: HEADER_SYMBOL, time: event.Time, pid: event.PID}}, nil
+	}
+	outcome, err := checkImportEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	var rec *logRecord = &logRecord{name: event.Name, time: event.Time, id: event.ID}
+	switch event.Kind {
+	case EVENT_START:
+		rec.symbol = START_INSTANCE_SYMBOL
+		if event.ID == 0 {
+			rec.symbol = START_SYMBOL
+		}
+	case EVENT_END:
+		if event.ID == 0 && outcome != OUTCOME_NONE {
+			return nil, fmt.Errorf("end event with an outcome but no instance ID")
+		} else if event.ID == 0 {
+			rec.symbol = END_SYMBOL
+		} else {
+			rec = endRecord(event.Name, event.Time, event.ID, outcome)
+		}
+	case EVENT_LABELS, EVENT_LAP:
+		if event.ID == 0 {
+			return nil, fmt.Errorf("%s event without an instance ID", event.Kind)
+		}
+		rec.symbol, rec.labels = LABEL_SYMBOL, event.Labels
+		if event.Kind == EVENT_LAP {
+			if err = checkImportName(event.Lap, "lap name"); err != nil {
+				return nil, err
+			}
+			rec.symbol, rec.labels, rec.lap = LAP_SYMBOL, nil, event.Lap
+		}
+	default:
+		return nil, fmt.Errorf("unknown event kind %q", event.Kind)
+	}
+	return []*logRecord{rec}, nil
+}
+
+/** Intervals without an ID are written as StartLogTimer and EndLogTimer would. */
+func intervalRecords(row Event, start int64, end int64) ([]*logRecord, error) {
+	outcome, err := checkImportEvent(row)
+	if err != nil {
+		return nil, err
+	}
+	if row.ID == 0 {
+		if outcome != OUTCOME_NONE || len(row.Labels) != 0 {
+			return nil, fmt.Errorf("interval with an outcome or labels but no instance ID")
+		}
+		return []*logRecord{
+			&logRecord{name: row.Name, symbol: START_SYMBOL, time: start},
+			&logRecord{name: row.Name, symbol: END_SYMBOL, time: end},
+		}, nil
+	}
+	var records []*logRecord = []*logRecord{&logRecord{name: row.Name, symbol: START_INSTANCE_SYMBOL, time: start, id: row.ID}}
+	if len(row.Labels) != 0 {
+		records = append(records, &logRecord{name: row.Name, symbol: LABEL_SYMBOL, time: start, id: row.ID, labels: row.Labels})
+	}
+	return append(records, endRecord(row.Name, end, row.ID, outcome)), nil
+}
@@ -0,0 +1,103 @@
+package timers
+
+import "bytes"
+import "encoding/csv"
+import "io/ioutil"
+import "os"
+import "strings"
+import "testing"
+
+func writeTabularLog() {
+	SetLogFile("/home/sam/timers/tabularlog")
+	StartLogTimer("legacy")
+	var h *Handle = StartLogHandle("request")
+	h.Lap("parsed")
+	h.AddLabels(Labels{"endpoint": "/users"})
+	EndLogTimer("legacy")
+	h.EndWithOutcome(OUTCOME_ERROR)
+	CloseLogFile()
+}
+
+func TestTabular1(t *testing.T) {
+	writeTabularLog()
+	var events []Event = ParseFileToEvents([]string{"/home/sam/timers/tabularlog"})
+	var kinds []string = make([]string, len(events))
+	for i, event := range events {
+		kinds[i] = event.Kind
+	}
+	if strings.Join(kinds, ",") != "header,start,start,lap,labels,end,end" || events[6].Outcome != "error" || events[3].Lap != "parsed" || events[0].PID != os.Getpid() {
+		t.Logf("Bad events %v", events)
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	WriteEventsCSV(&buf, events)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 8 || rows[5][6] != "endpoint=/users" || rows[2][3] != "/home/sam/timers/tabularlog" || rows[1][8] != hostname {
+		t.Logf("Bad event CSV %v %v", rows, err)
+		t.Fail()
+	}
+	buf.Reset()
+	WriteIntervalsCSV(&buf, ParseFilesToIntervals([]string{"/home/sam/timers/tabularlog"}))
+	rows, err = csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 3 || rows[0][3] != "duration" || rows[2][6] != "error" {
+		t.Logf("Bad interval CSV %v %v", rows, err)
+		t.Fail()
+	}
+}
+
+func TestTabular2(t *testing.T) {
+	writeTabularLog()
+	var buf bytes.Buffer
+	WriteEventsJSONLines(&buf, ParseFileToEvents([]string{"/home/sam/timers/tabularlog"}))
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/tabularimport")
+	if err := ImportJSONLines(&buf, f); err != nil {
+		t.Logf("Import failed: %v", err)
+		t.Fail()
+	}
+	f.Close()
+	original, _ := ioutil.ReadFile("/home/sam/timers/tabularlog")
+	imported, _ := ioutil.ReadFile("/home/sam/timers/tabularimport")
+	if !bytes.Equal(original, imported) {
+		t.Log("Events did not round-trip")
+		t.Fail()
+	}
+
+	buf.Reset()
+	var intervals []Interval = ParseFilesToIntervals([]string{"/home/sam/timers/tabularlog"})
+	WriteIntervalsJSONLines(&buf, intervals)
+	f, _ = os.Create("/home/sam/timers/tabularimport")
+	if err := ImportJSONLines(&buf, f); err != nil {
+		t.Logf("Import failed: %v", err)
+		t.Fail()
+	}
+	f.Close()
+	var reparsed []Interval = ParseMapToIntervals(ParseFileToMap([]string{"/home/sam/timers/tabularimport"}))
+	if len(reparsed) != 2 || reparsed[1].ID != intervals[1].ID || reparsed[1].Outcome != OUTCOME_ERROR || reparsed[1].Labels["endpoint"] != "/users" {
+		t.Logf("Intervals did not round-trip: %v", reparsed)
+		t.Fail()
+	}
+}
+
+func TestTabular3(t *testing.T) {
+	var bad []string = []string{
+		`{"name":"x","kind":"bogus","time":1}`,
+		`{"name":"x","kind":"labels","time":1,"labels":{"a":"b"}}`,
+		`{"name":"x","kind":"end","time":1,"outcome":"error"}`,
+		`{"name":"","kind":"start","time":1}`,
+		`{"name":"x","start":1}`,
+		`{"name":"x","kind":"end","time":1,"id":"5","outcome":"weird"}`,
+		`not json`,
+	}
+	var buf bytes.Buffer
+	for _, line := range bad {
+		if err := ImportJSONLines(strings.NewReader("\n" + line + "\n"), &buf); err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Logf("Bad line %s gave %v", line, err)
+			t.Fail()
+		}
+	}
+	if buf.Len() != 0 {
+		t.Log("Records were written for bad lines")
+		t.Fail()
+	}
+}
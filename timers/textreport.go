@@ -0,0 +1,214 @@
+package timers
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	)
+
+/* TEXT REPORTS
+   Plain-text views for a terminal: a latency histogram per timer, and a tree
+   of how nested timers break down, in the spirit of a flame graph. */
+
+const DEFAULT_REPORT_WIDTH int = 40
+
+/** Bin 0 holds deltas of 0; bin k holds deltas in [2^(k-1), 2^k) ns. */
+func histogramBin(delta int64) int {
+	if delta <= 0 {
+		return 0
+	}
+	return bits.Len64(uint64(delta))
+}
+
+func binBounds(bin int) (int64, int64) {
+	if bin == 0 {
+		return 0, 1
+	}
+	return int64(1) << uint(bin - 1), int64(1) << uint(bin)
+}
+
+func bar(count int64, max int64, width int) string {
+	if max == 0 {
+		return ""
+	}
+	var n int = int(count * int64(width) / max)
+	if n == 0 && count > 0 {
+		n = 1
+	}
+	return strings.Repeat("@", n)
+}
+
+/** Writes a histogram with power-of-two bins for each timer, in name order.
+    Bars are at most width characters, or DEFAULT_REPORT_WIDTH if width is 0. */
+func WriteHistograms(writer io.Writer, deltamap map[string][]int64, width int) error {
+	if width <= 0 {
+		width = DEFAULT_REPORT_WIDTH
+	}
+	var names []string = make([]string, 0, len(deltamap))
+	for name, deltas := range deltamap {
+		if len(deltas) != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var w *tabwriter.Writer = tabwriter.NewWriter(writer, 0, 8, 1, ' ', 0)
+	for i, name := range names {
+		var stats DeltaStats = SummarizeDeltas(deltamap[name])
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (n=%d, min=%v, p50=%v, p99=%v, max=%v)\n", name, stats.Count, time.Duration(stats.Min),
+			time.Duration(stats.P50), time.Duration(stats.P99), time.Duration(stats.Max))
+		var counts map[int]int64 = make(map[int]int64)
+		var most int64 = 0
+		for _, delta := range deltamap[name] {
+			var bin int = histogramBin(delta)
+			counts[bin]++
+			if counts[bin] > most {
+				most = counts[bin]
+			}
+		}
+		for bin := histogramBin(stats.Min); bin <= histogramBin(stats.Max); bin++ {
+			lo, hi := binBounds(bin)
+			fmt.Fprintf(w, "  [%v,\t%v)\t%d\t|%-*s|\n", time.Duration(lo), time.Duration(hi), counts[bin], width, bar(counts[bin], most, width))
+		}
+	}
+	return w.Flush()
+}
+
+type flameNode struct {
+	name string
+	count int64
+	total int64
+	children map[string]*flameNode
+}
+
+func (node *flameNode) child(name string) *flameNode {
+	if node.children == nil {
+		node.children = make(map[string]*flameNode)
+	}
+	c, ok := node.children[name]
+	if !ok {
+		c = &flameNode{name: name}
+		node.children[name] = c
+	}
+	return c
+}
+
+/** Builds a tree of timer names in which each interval sits under the
+    innermost interval from the same process that contains it. Intervals with
+    the same path of names are added together. */
+func buildFlameTree(intervals []Interval) *flameNode {
+	var sorted []Interval = append([]Interval(nil), intervals...)
+	sort.SliceStable(sorted, func (i int, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End > sorted[j].End
+	})
+	var root *flameNode = &flameNode{}
+	for _, process := range traceProcesses(sorted) {
+		var stack []Interval
+		var nodes []*flameNode
+		for _, interval := range process.intervals {
+			for len(stack) > 0 && stack[len(stack) - 1].End < interval.End {
+				stack, nodes = stack[:len(stack) - 1], nodes[:len(nodes) - 1]
+			}
+			var parent *flameNode = root
+			if len(nodes) > 0 {
+				parent = nodes[len(nodes) - 1]
+			}
+			var node *flameNode = parent.child(interval.Name)
+			node.count++
+			node.total += interval.Delta()
+			stack, nodes = append(stack, interval), append(nodes, node)
+		}
+	}
+	for _, c := range root.children {
+		root.total += c.total
+	}
+	return root
+}
+
+/** Writes the tree of nested timers with each timer's count, total time, self
+    time (the part not covered by nested timers) and share of the top-level
+    total. Self time is an estimate when nested timers overlap each other. */
+func WriteFlameTree(writer io.Writer, intervals []Interval, width int) error {
+	if width <= 0 {
+		width = DEFAULT_REPORT_WIDTH
+	}
+	var root *flameNode = buildFlameTree(intervals)
+	var w *tabwriter.Writer = tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tcount\ttotal\tself\tshare\t")
+	var walk func(node *flameNode, depth int)
+	walk = func (node *flameNode, depth int) {
+		var children []*flameNode = make([]*flameNode, 0, len(node.children))
+		var childTotal int64 = 0
+		for _, c := range node.children {
+			children = append(children, c)
+			childTotal += c.total
+		}
+		sort.Slice(children, func (i int, j int) bool {
+			if children[i].total != children[j].total {
+				return children[i].total > children[j].total
+			}
+			return children[i].name < children[j].name
+		})
+		if depth >= 0 {
+			var self int64 = node.total - childTotal
+			if self < 0 {
+				self = 0
+			}
+			var share float64 = 0
+			if root.total > 0 {
+				share = 100 * float64(node.total) / float64(root.total)
+			}
+			fmt.Fprintf(w, "%s%s\t%d\t%v\t%v\t%5.1f%%\t%s\n", strings.Repeat("  ", depth), node.name, node.count,
+				time.Duration(node.total), time.Duration(self), share, bar(node.total, root.total, width))
+		}
+		for _, c := range children {
+			walk(c, depth + 1)
+		}
+	}
+	walk(root, -1)
+	return w.Flush()
+}
+
+/** Writes the histograms and then the tree for the given log files. The files
+    are parsed once, each on its own as in ParseFilesToIntervals, so the
+    histograms count the same intervals as the tree. */
+func WriteLogReport(writer io.Writer, filenames []string, width int) error {
+	var intervals []Interval = ParseFilesToIntervals(filenames)
+	return writeReport(writer, intervalDeltas(intervals), intervals, width)
+}
+
+/** Quiet about timers that are still running, since a live buffer almost
+    always has some. */
+func WriteBufferedLogReport(writer io.Writer, width int) error {
+	bufferLock.Lock()
+	var intervals []Interval = parseMapToIntervals(bufferedTimers, func (Anomaly) {})
+	bufferLock.Unlock()
+	return writeReport(writer, intervalDeltas(intervals), intervals, width)
+}
+
+func intervalDeltas(intervals []Interval) map[string][]int64 {
+	var deltamap map[string][]int64 = make(map[string][]int64)
+	for _, interval := range intervals {
+		deltamap[interval.Name] = append(deltamap[interval.Name], interval.Delta())
+	}
+	return deltamap
+}
+
+func writeReport(writer io.Writer, deltamap map[string][]int64, intervals []Interval, width int) error {
+	if err := WriteHistograms(writer, deltamap, width); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer); err != nil {
+		return err
+	}
+	return WriteFlameTree(writer, intervals, width)
+}
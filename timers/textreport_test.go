@@ -0,0 +1,94 @@
+package timers
+
+import "bytes"
+import "os"
+import "strings"
+import "testing"
+
+func TestTextReport1(t *testing.T) {
+	var deltamap map[string][]int64 = map[string][]int64{
+		"req": []int64{1000, 1100, 1500, 3000, 0},
+		"empty": []int64{},
+	}
+	var buf bytes.Buffer
+	WriteHistograms(&buf, deltamap, 10)
+	var lines []string = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	// A heading, then every bin from [0s, 1ns) up to [2.048µs, 4.096µs).
+	if len(lines) != 14 || !strings.HasPrefix(lines[0], "req (n=5,") || strings.Contains(buf.String(), "empty") {
+		t.Logf("Bad histogram:\n%s", buf.String())
+		t.Fail()
+		return
+	}
+	if !strings.Contains(lines[12], "[1.024µs, 2.048µs) 2 |@@@@@@@@@@|") || !strings.Contains(lines[13], "|@@@@@     |") || !strings.Contains(lines[2], " 0 |          |") {
+		t.Logf("Bad bars:\n%s", buf.String())
+		t.Fail()
+	}
+}
+
+func TestTextReport2(t *testing.T) {
+	var intervals []Interval = []Interval{
+		Interval{Name: "request", Start: 0, End: 100},
+		Interval{Name: "db", Start: 10, End: 40},
+		Interval{Name: "db", Start: 50, End: 70},
+		Interval{Name: "render", Start: 80, End: 90},
+		Interval{Name: "request", Start: 200, End: 300},
+		Interval{Name: "db", Start: 210, End: 250},
+		Interval{Name: "gc", Start: 95, End: 150},
+		Interval{Name: "request", Start: 0, End: 50, Source: "other"},
+	}
+	var root *flameNode = buildFlameTree(intervals)
+	var request *flameNode = root.children["request"]
+	if len(root.children) != 2 || request.count != 3 || request.total != 250 || request.children["db"].count != 3 || request.children["db"].total != 90 {
+		t.Logf("Bad tree %+v", request)
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	WriteFlameTree(&buf, intervals, 10)
+	var lines []string = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[1], "request ") || !strings.HasPrefix(lines[2], "  db ") || !strings.HasPrefix(lines[4], "gc ") {
+		t.Logf("Bad flame tree:\n%s", buf.String())
+		t.Fail()
+		return
+	}
+	if !strings.Contains(lines[1], "150ns") || !strings.Contains(lines[1], " 82.0%") || !strings.HasSuffix(lines[1], "@@@@@@@@") {
+		t.Logf("Bad request line %q", lines[1])
+		t.Fail()
+	}
+}
+
+func TestTextReport3(t *testing.T) {
+	defer ResetLogBuffer()
+	var outer *Handle = StartBufferedLogHandle("outer")
+	StartBufferedLogHandle("inner").End()
+	outer.End()
+	var running *Handle = StartBufferedLogHandle("running")
+	var buf bytes.Buffer
+	if err := WriteBufferedLogReport(&buf, 0); err != nil || !strings.Contains(buf.String(), "\n  inner ") || strings.Contains(buf.String(), "running") {
+		t.Logf("Bad buffered report %v:\n%s", err, buf.String())
+		t.Fail()
+	}
+	running.End()
+	var f *os.File
+	f, _ = os.Create("/home/sam/timers/reportlog")
+	WriteLogBuffer(f)
+	f.Close()
+	SetLogFile("/home/sam/timers/reportmixed")
+	StartLogTimer("legacy")
+	StartLogHandle("handle").End()
+	EndLogTimer("legacy")
+	StartLogHandle("dangling")
+	CloseLogFile()
+	defer SetAnomalyReporter(printAnomaly)
+	var reported []Anomaly
+	SetAnomalyReporter(func (a Anomaly) { reported = append(reported, a) })
+	var fromFile bytes.Buffer
+	WriteLogReport(&fromFile, []string{"/home/sam/timers/reportlog", "/home/sam/timers/reportmixed"}, 0)
+	if len(reported) != 1 || reported[0].Name != "dangling" || strings.Contains(fromFile.String(), "dangling") {
+		t.Logf("Anomaly reported %d times", len(reported))
+		t.Fail()
+	}
+	if !strings.Contains(fromFile.String(), "outer (n=1,") || !strings.Contains(fromFile.String(), "\n  inner ") || !strings.Contains(fromFile.String(), "\n  handle ") {
+		t.Logf("Bad log report:\n%s", fromFile.String())
+		t.Fail()
+	}
+}
@@ -2,11 +2,16 @@ package timers
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 	)
 
@@ -14,8 +19,21 @@ import (
 
 var timers map[string]int64 = make(map[string]int64)
 var timersEnd map[string]int64 = make(map[string]int64)
+var timersOutcome map[string]Outcome = make(map[string]Outcome)
+var timersLabels map[string]Labels = make(map[string]Labels)
+var timersLaps map[string][]Lap = make(map[string][]Lap)
+var timersPaused map[string]int64 = make(map[string]int64) // when each paused timer was paused
+var timersIdle map[string]int64 = make(map[string]int64) // total time spent paused in finished pauses
+var timersTotals map[string]*CumulativeTimer = make(map[string]*CumulativeTimer)
+var timersIDs map[string]uint64 = make(map[string]uint64) // the current run's instance ID in WriteTimerLog
+
+/** Guards all of the maps above, so timers can be inspected from another
+    goroutine. Exported functions take it; unexported helpers assume it's held. */
+var timersLock sync.Mutex
 
 func StartTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
 	if _, ok := timers[name]; ok {
 		panic(fmt.Sprintf("Attempted to start running timer %s", name))
 	} else {
@@ -24,6 +42,12 @@ func StartTimer(name string) {
 }
 
 func EndTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	endTimer(name)
+}
+
+func endTimer(name string) {
 	if _, ok := timersEnd[name]; ok {
 		panic(fmt.Sprintf("Attempted to end stopped timer %s", name))
 	} else {
@@ -31,7 +55,75 @@ func EndTimer(name string) {
 	}
 }
 
+func endTimerWithOutcome(name string, outcome Outcome) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	endTimer(name)
+	timersOutcome[name] = outcome
+}
+
+/** Returns OUTCOME_NONE unless the timer was ended by one of the Measure or
+    Time helpers. */
+func GetTimerOutcome(name string) Outcome {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	return timersOutcome[name]
+}
+
+/** Labels may be added while the timer is running or after it has ended; a
+    label that is set twice keeps the later value. */
+func LabelTimer(name string, labels Labels) {
+	checkLabels(name, labels)
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	if _, ok := timers[name]; !ok {
+		panic(fmt.Sprintf("Attempted to label timer %s, which is not running", name))
+	}
+	if timersLabels[name] == nil {
+		timersLabels[name] = make(Labels)
+	}
+	timersLabels[name].merge(labels)
+}
+
+func GetTimerLabels(name string) Labels {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	return timersLabels[name].copy()
+}
+
+/** Time spent paused up to the given time, including any pause in progress. */
+func pausedTime(name string, now int64) int64 {
+	var idle int64 = timersIdle[name]
+	if pausedAt, ok := timersPaused[name]; ok && now > pausedAt {
+		idle += now - pausedAt
+	}
+	return idle
+}
+
+/** Returns the active time between start and end, excluding pauses, or -1 if
+    the timer was never started and -2 if it hasn't ended. */
 func GetTimerDelta(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	return getTimerDelta(name)
+}
+
+func getTimerDelta(name string) int64 {
+	if valStart, ok := timers[name]; ok {
+		if valEnd, ok := timersEnd[name]; ok {
+			return valEnd - valStart - pausedTime(name, valEnd)
+		} else {
+			return -2
+		}
+	} else {
+		return -1
+	}
+}
+
+/** Like GetTimerDelta, but wall-clock time including pauses. */
+func GetTimerElapsed(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
 	if valStart, ok := timers[name]; ok {
 		if valEnd, ok := timersEnd[name]; ok {
 			return valEnd - valStart
@@ -43,17 +135,41 @@ func GetTimerDelta(name string) int64 {
 	}
 }
 
+/** Returns the active time so far and restarts the timer. A paused timer stays
+    paused. */
 func ResetTimer(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
 	if val, ok := timers[name]; ok {
 		now := time.Now().UnixNano()
 		timers[name] = now
-		return now - val
+		delete(timersLaps, name)
+		var idle int64 = pausedTime(name, now)
+		delete(timersIdle, name)
+		if _, ok = timersPaused[name]; ok {
+			timersPaused[name] = now
+		}
+		return now - val - idle
 	} else {
 		panic(fmt.Sprintf("Attempted to reset timer %s, which is not running", name))
 	}
 }
 
+/** Returns the active time so far, excluding pauses. */
 func PollTimer(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	if val, ok := timers[name]; ok {
+		now := time.Now().UnixNano()
+		return now - val - pausedTime(name, now)
+	} else {
+		panic(fmt.Sprintf("Attempted to poll timer %s, which is not running", name))
+	}
+}
+
+func PollTimerElapsed(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
 	if val, ok := timers[name]; ok {
 		return time.Now().UnixNano() - val
 	} else {
@@ -61,120 +177,484 @@ func PollTimer(name string) int64 {
 	}
 }
 
+/** Time from now until ResumeTimer is excluded from the timer's active time. */
+func PauseTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	if _, ok := timers[name]; !ok {
+		panic(fmt.Sprintf("Attempted to pause timer %s, which is not running", name))
+	}
+	if _, ok := timersEnd[name]; ok {
+		panic(fmt.Sprintf("Attempted to pause stopped timer %s", name))
+	}
+	if _, ok := timersPaused[name]; ok {
+		panic(fmt.Sprintf("Attempted to pause paused timer %s", name))
+	}
+	timersPaused[name] = time.Now().UnixNano()
+}
+
+func ResumeTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	pausedAt, ok := timersPaused[name]
+	if !ok {
+		panic(fmt.Sprintf("Attempted to resume timer %s, which is not paused", name))
+	}
+	if _, ok = timersEnd[name]; ok {
+		panic(fmt.Sprintf("Attempted to resume stopped timer %s", name))
+	}
+	timersIdle[name] += time.Now().UnixNano() - pausedAt
+	delete(timersPaused, name)
+}
+
 func DeleteTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	deleteTimer(name)
+}
+
+func deleteTimer(name string) {
 	if _, ok := timers[name]; ok {
 		delete(timers, name)
 	} else {
 		panic(fmt.Sprintf("Attempted to stop timer %s, which is not running", name))
 	}
 	delete(timersEnd, name)
+	delete(timersOutcome, name)
+	delete(timersLabels, name)
+	delete(timersLaps, name)
+	delete(timersPaused, name)
+	delete(timersIdle, name)
+	delete(timersTotals, name)
+	delete(timersIDs, name)
+}
+
+/* CUMULATIVE HASHTABLE TIMERS
+   Hashtable timers that can be started and ended any number of times, keeping
+   totals across the runs. Each run is otherwise an ordinary hashtable timer. */
+
+type CumulativeTimer struct {
+	Count int64 // completed runs
+	Total int64 // active time summed over completed runs
+	Last int64 // active time of the most recent completed run
+}
+
+func (c CumulativeTimer) Mean() int64 {
+	if c.Count == 0 {
+		return 0
+	}
+	return c.Total / c.Count
+}
+
+/** Starts a new run. Unlike StartTimer, this may be called again once the
+    previous run has ended; labels carry over between runs. */
+func StartCumulativeTimer(name string) {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	restartTimer(name)
+	if _, ok := timersTotals[name]; !ok {
+		timersTotals[name] = &CumulativeTimer{}
+	}
+}
+
+/** Starts a timer that may have ended before, clearing what belonged to the
+    previous run but keeping labels and totals. */
+func restartTimer(name string) {
+	if _, ok := timers[name]; ok {
+		if _, ok = timersEnd[name]; !ok {
+			panic(fmt.Sprintf("Attempted to start running timer %s", name))
+		}
+	}
+	delete(timersEnd, name)
+	delete(timersOutcome, name)
+	delete(timersLaps, name)
+	delete(timersPaused, name)
+	delete(timersIdle, name)
+	delete(timersIDs, name)
+	timers[name] = time.Now().UnixNano()
+}
+
+/** Ends the current run and returns its active time. */
+func EndCumulativeTimer(name string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	totals, ok := timersTotals[name]
+	if !ok {
+		panic(fmt.Sprintf("Attempted to end timer %s, which is not cumulative", name))
+	}
+	endTimer(name)
+	var delta int64 = getTimerDelta(name)
+	totals.Count++
+	totals.Total += delta
+	totals.Last = delta
+	return delta
+}
+
+/** Doesn't include a run in progress. */
+func GetCumulativeTimer(name string) CumulativeTimer {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	totals, ok := timersTotals[name]
+	if !ok {
+		panic(fmt.Sprintf("Attempted to summarize timer %s, which is not cumulative", name))
+	}
+	return *totals
+}
+
+/** Records a named split on a running timer and returns the time since the
+    previous lap, or since the start for the first lap. Splits are wall-clock
+    time and include any time the timer spent paused. */
+func LapTimer(name string, lapName string) int64 {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	start, ok := timers[name]
+	if !ok {
+		panic(fmt.Sprintf("Attempted to lap timer %s, which is not running", name))
+	}
+	if _, ok = timersEnd[name]; ok {
+		panic(fmt.Sprintf("Attempted to lap stopped timer %s", name))
+	}
+	var now int64 = time.Now().UnixNano()
+	var laps []Lap = timersLaps[name]
+	var lap Lap = Lap{lapName, now, now - start}
+	if len(laps) != 0 {
+		lap.Split = now - laps[len(laps) - 1].Time
+	}
+	timersLaps[name] = append(laps, lap)
+	return lap.Split
+}
+
+/** Laps are in the order they were taken. */
+func GetTimerLaps(name string) []Lap {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	return append([]Lap(nil), timersLaps[name]...)
+}
+
+/** Writes the timer, with its labels and laps, as a single instance in the log
+    format, so it can be parsed alongside log timers. Every write of the same
+    run uses the same instance ID, so repeated writes can be correlated; a
+    restarted timer gets a new one. */
+func WriteTimerLog(writer io.Writer, name string) error {
+	timersLock.Lock()
+	defer timersLock.Unlock()
+	start, ok := timers[name]
+	if !ok {
+		panic(fmt.Sprintf("Attempted to write timer %s, which does not exist", name))
+	}
+	id, ok := timersIDs[name]
+	if !ok {
+		id = nextInstanceID()
+		timersIDs[name] = id
+	}
+	var inst *timerInstance = &timerInstance{start: start, started: true, labels: timersLabels[name], laps: timersLaps[name]}
+	inst.end, inst.ended = timersEnd[name]
+	inst.outcome = timersOutcome[name]
+	return writeInstance(writer, name, id, inst)
 }
 
 /* FILE-BASED TIMERS */
 
-var timerDir string
+var timerDir string // the current namespace's directory
+var timerRoot string // the collection's top-level directory
+var timerNamespace string
+var fileTimersStrict bool = false
+var fileTimersAutoCreate bool = false
+
+const LOCK_FILE_NAME string = ".lock"
+
+/** In strict mode, starting a file timer that is running, or ending one that
+    has already ended, panics as it would for a hashtable timer. */
+func SetFileTimerStrict(strict bool) {
+	fileTimersStrict = strict
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
 
+/** When on, SetFileTimerCollection creates a missing directory instead of
+    panicking. */
+func SetFileTimerAutoCreate(create bool) {
+	fileTimersAutoCreate = create
+}
+
+/** Also returns to the collection's root namespace. */
 func SetFileTimerCollection (dirString string) {
+	if fileTimersAutoCreate {
+		os.MkdirAll(dirString, 0755)
+	}
 	fi, err := os.Stat(dirString)
 	if err == nil && fi.IsDir() {
 		lastIndex := len(dirString) - 1
 		if dirString[lastIndex] == '/' {
-			timerDir = dirString[0:lastIndex]
+			timerRoot = dirString[0:lastIndex]
 		} else {
-			timerDir = dirString
+			timerRoot = dirString
 		}
+		timerDir = timerRoot
+		timerNamespace = ""
 	} else {
 		panic(fmt.Sprintf("Attempted to set Timer collection to invalid directory %s", dirString))
 	}
 }
 
+func timerPath(dir string, name string, suffix string) string {
+	return fmt.Sprintf("%s/%s%s", dir, encodeTimerName(name), suffix)
+}
+
+func expandFilePathRecord(name string) string {
+	return timerPath(timerDir, name, FILE_TIMER_SUFFIX)
+}
+
+/* Paths of the legacy two-file format, which is still read but no longer written. */
+
 func expandFilePathStart(name string) string {
-	return fmt.Sprintf("%s/%s_start", timerDir, name)
+	return timerPath(timerDir, name, "_start")
 }
 
 func expandFilePathEnd(name string) string {
-	return fmt.Sprintf("%s/%s_end", timerDir, name)
+	return timerPath(timerDir, name, "_end")
+}
+
+func expandFilePathLabels(name string) string {
+	return timerPath(timerDir, name, "_labels")
 }
 
-/** This will overwrite any existing timers. I didn't add error checking here
-    because I reasoned that we may see some of the same timers from previous
-    runs of the program. */
+/** Starting a timer whose last run has ended begins a new run. Starting a timer
+    that is still running overwrites its start, unless strict mode is on. I
+    didn't add error checking here because I reasoned that we may see some of
+    the same timers from previous runs of the program. */
 func StartFileTimer(name string) {
-	writeFileTimer(name, expandFilePathStart)
+	defer lockFileCollection()()
+	var record *fileTimerRecord = loadFileTimerForUpdate(name)
+	var run *FileTimerRun = record.lastRun()
+	if run != nil && run.Start != 0 && run.End == 0 {
+		if fileTimersStrict {
+			panic(fmt.Sprintf("Attempted to start running file timer %s", name))
+		}
+	} else if run == nil || run.Start != 0 || run.End != 0 {
+		run = record.newRun()
+	}
+	run.Start = time.Now().UnixNano()
+	run.StartPID, run.StartHost = os.Getpid(), hostname
+	saveFileTimer(name, record)
 }
 
 func EndFileTimer(name string) {
-	writeFileTimer(name, expandFilePathEnd)
+	endFileTimerWithOutcome(name, OUTCOME_NONE)
 }
 
-func writeFileTimer(name string, nameFinder func (string) string) {
-	file, err := os.Create(nameFinder(name))
-	defer file.Close()
-	if err == nil {
-		err = binary.Write(file, binary.LittleEndian, time.Now().UnixNano())
-		if err != nil {
-			panic(fmt.Sprintf("Could not write to file timer %s: %v", nameFinder(name), err))
-		}
+/** Ending a timer that has already ended overwrites its end, unless strict
+    mode is on. */
+func endFileTimerWithOutcome(name string, outcome Outcome) {
+	defer lockFileCollection()()
+	var record *fileTimerRecord = loadFileTimerForUpdate(name)
+	var run *FileTimerRun = record.lastRun()
+	if run == nil {
+		run = record.newRun()
+	} else if run.End != 0 && fileTimersStrict {
+		panic(fmt.Sprintf("Attempted to end stopped file timer %s", name))
+	}
+	setFileTimerEnd(run, outcome)
+	saveFileTimer(name, record)
+}
+
+func setFileTimerEnd(run *FileTimerRun, outcome Outcome) {
+	run.End = time.Now().UnixNano()
+	run.Outcome = outcome
+	run.EndPID, run.EndHost = os.Getpid(), hostname
+}
+
+/** Ends or deletes the timer only if it is still the run that began at start,
+    for callers like the watchdog that act on an earlier listing. */
+func settleFileTimer(name string, start int64, outcome Outcome, remove bool) bool {
+	defer lockFileCollection()()
+	record, err := loadFileTimer(name)
+	if err != nil {
+		return false
+	}
+	var run *FileTimerRun = record.lastRun()
+	if run == nil || run.Start != start || run.End != 0 {
+		return false
+	}
+	if remove {
+		removeFileTimer(name)
 	} else {
-		panic(fmt.Sprintf("Could not write to file timer %s: %v", nameFinder(name), err))
+		setFileTimerEnd(run, outcome)
+		saveFileTimer(name, record)
 	}
+	return true
 }
 
-func readFileTimer(name string, nameFinder func (string) string) int64 {
-	file, err := os.Open(nameFinder(name))
-	defer file.Close()
-	var fileTime int64
+/** Returns OUTCOME_NONE unless the last run was ended by one of the Measure or
+    Time helpers, or by the watchdog. */
+func GetFileTimerOutcome(name string) Outcome {
+	record, err := loadFileTimer(name)
+	if err != nil || record.lastRun() == nil || record.lastRun().End == 0 {
+		panic(fmt.Sprintf("Could not open file timer %s: %v", name, err))
+	}
+	return record.lastRun().Outcome
+}
+
+/** Labels belong to the timer's last run and are merged with any labels
+    already there. Labelling a timer that doesn't exist yet keeps the labels for
+    its first run. */
+func LabelFileTimer(name string, labels Labels) {
+	checkLabels(name, labels)
+	defer lockFileCollection()()
+	var record *fileTimerRecord = loadFileTimerForUpdate(name)
+	var run *FileTimerRun = record.lastRun()
+	if run == nil {
+		run = record.newRun()
+	}
+	if run.Labels == nil {
+		run.Labels = make(Labels)
+	}
+	run.Labels.merge(labels)
+	saveFileTimer(name, record)
+}
+
+func GetFileTimerLabels(name string) Labels {
+	record, err := loadFileTimer(name)
+	if err == ErrFileTimerMissing || err == nil && record.lastRun() == nil {
+		return make(Labels)
+	} else if err != nil {
+		panic(fmt.Sprintf("Could not read labels for file timer %s: %v", name, err))
+	}
+	return record.lastRun().Labels.copy()
+}
+
+var ErrFileTimerMissing error = errors.New("file timer does not exist")
+var ErrFileTimerCorrupt error = errors.New("file timer is truncated or corrupt")
+
+/** Writes to a temporary file in the same directory, syncs it and renames it
+    into place, so a reader sees either the old contents or the new ones and a
+    crash can't leave a truncated file behind. */
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "." + filepath.Base(path) + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
 	if err == nil {
-		err = binary.Read(file, binary.LittleEndian, &fileTime)
-		if err != nil {
-			panic(fmt.Sprintf("Could not poll file timer %s: %v", nameFinder(name), err))
-		}
-		return fileTime
-	} else {
-		panic(fmt.Sprintf("Could not open file timer %s: %v", nameFinder(name), err))
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// Sync the directory too so the rename itself survives a crash. Not every
+	// platform supports this, so errors are ignored.
+	if dir, derr := os.Open(filepath.Dir(path)); derr == nil {
+		dir.Sync()
+		dir.Close()
 	}
+	return nil
 }
 
-func GetFileTimerDelta(name string) (delta int64) {
-	var started bool = false
-	defer func () {
-			if r := recover(); r != nil {
-				if started {
-					delta = -2 // indicates timer was started but never ended
-				} else {
-				 	delta = -1 // indicates timer was never started
-				}
-			}
-		}()
-	var startTime int64 = readFileTimer(name, expandFilePathStart)
-	started = true
-	var endTime int64 = readFileTimer(name, expandFilePathEnd)
-	delta = endTime - startTime
-	return
+/** Unlike the other file timer functions, these return an error instead of
+    panicking, so that callers can tell ErrFileTimerMissing apart from
+    ErrFileTimerCorrupt. They refer to the timer's last run. */
+func GetFileTimerStart(name string) (int64, error) {
+	record, err := loadFileTimer(name)
+	if err != nil {
+		return 0, err
+	} else if record.lastRun() == nil || record.lastRun().Start == 0 {
+		return 0, ErrFileTimerMissing
+	}
+	return record.lastRun().Start, nil
+}
+
+func GetFileTimerEnd(name string) (int64, error) {
+	record, err := loadFileTimer(name)
+	if err != nil {
+		return 0, err
+	} else if record.lastRun() == nil || record.lastRun().End == 0 {
+		return 0, ErrFileTimerMissing
+	}
+	return record.lastRun().End, nil
+}
+
+/** Every run of the timer, oldest first. */
+func GetFileTimerHistory(name string) ([]FileTimerRun, error) {
+	record, err := loadFileTimer(name)
+	if err != nil {
+		return nil, err
+	}
+	return record.Runs, nil
+}
+
+func GetFileTimerDelta(name string) int64 {
+	startTime, err := GetFileTimerStart(name)
+	if err == ErrFileTimerCorrupt {
+		return -3 // indicates a timer file is corrupt
+	} else if err != nil {
+		return -1 // indicates timer was never started
+	}
+	endTime, err := GetFileTimerEnd(name)
+	if err == ErrFileTimerCorrupt {
+		return -3
+	} else if err != nil {
+		return -2 // indicates timer was started but never ended
+	}
+	return endTime - startTime
 }
 
 func PollFileTimer(name string) int64 {
-	return time.Now().UnixNano() - readFileTimer(name, expandFilePathStart)
+	start, err := GetFileTimerStart(name)
+	if err != nil {
+		panic(fmt.Sprintf("Could not poll file timer %s: %v", name, err))
+	}
+	return time.Now().UnixNano() - start
 }
 
 func DeleteFileTimer(name string) {
-	var err error = os.Remove(expandFilePathStart(name))
-	if err != nil {
-		panic(fmt.Sprintf("Could not stop file timer %s: %v", name, err))
+	defer lockFileCollection()()
+	if !fileExists(expandFilePathRecord(name)) && !fileExists(expandFilePathStart(name)) {
+		panic(fmt.Sprintf("Could not stop file timer %s: %v", name, ErrFileTimerMissing))
 	}
-	os.Remove(expandFilePathEnd(name))
+	removeFileTimer(name)
 }
 
 func DeleteFileTimerIfExists(name string) {
+	defer lockFileCollection()()
+	removeFileTimer(name)
+}
+
+func removeFileTimer(name string) {
+	os.Remove(expandFilePathRecord(name))
+	removeLegacyFileTimer(name)
+}
+
+func removeLegacyFileTimer(name string) {
 	os.Remove(expandFilePathStart(name))
 	os.Remove(expandFilePathEnd(name))
+	os.Remove(expandFilePathLabels(name))
 }
 
 /* LOG-BASED TIMERS */
 
 var file *os.File = nil
+var logLock sync.Mutex
 
+/** The log begins with a header naming the host and process, as do logs
+    written by WriteLogBuffer. Readers from before headers were added take the
+    header for an end and misread everything after it, so these logs can't be
+    parsed by older versions of this package. */
 func SetLogFile(filepath string) {
+	logLock.Lock()
+	defer logLock.Unlock()
 	if file != nil {
 		file.Close()
 	}
@@ -183,9 +663,21 @@ func SetLogFile(filepath string) {
 	if err != nil {
 		panic(fmt.Sprintf("Attempted to set log to invalid filepath %v", err))
 	}
+	_, err = file.Write(headerRecord().encode())
+	if err != nil {
+		panic(fmt.Sprintf("Failed to write header to log file: %v", err))
+	}
+}
+
+/** Identifies the host and process that wrote a log, so that logs from several
+    hosts can be merged. */
+func headerRecord() *logRecord {
+	return &logRecord{name: hostname, symbol: HEADER_SYMBOL, time: time.Now().UnixNano(), pid: os.Getpid()}
 }
 
 func CloseLogFile() {
+	logLock.Lock()
+	defer logLock.Unlock()
 	if file == nil {
 		panic(fmt.Sprintf("Attempted to close log file, but not log file is active"))
 	} else {
@@ -196,24 +688,161 @@ func CloseLogFile() {
 }
 
 func logEvent(name string, tag string) {
-	_, err := file.WriteString(fmt.Sprintf("%s\x00%s", name, tag))
-	if err == nil {
-		err = binary.Write(file, binary.LittleEndian, time.Now().UnixNano())
-		if err != nil {
-			panic(fmt.Sprintf("Failed to write current time to file: %v", err))
-		}
-	} else {
-		panic(fmt.Sprintf("Failed to write timer name to file: %v", err))
-	}	
+	writeRecord(&logRecord{name: name, symbol: tag, time: time.Now().UnixNano()})
+}
+
+/** The whole record goes out in a single write, so concurrent timers can't
+    interleave their records. */
+func writeRecord(rec *logRecord) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	_, err := file.Write(rec.encode())
+	if err != nil {
+		panic(fmt.Sprintf("Failed to write timer %s to file: %v", rec.name, err))
+	}
 }
 
 const (
 	START_SYMBOL string = "s"
 	END_SYMBOL string = "e"
-	LEN_TYPE_SYMBOL int = 1 // both START_SYMBOL and END_SYMBOL have this length
+	START_INSTANCE_SYMBOL string = "S" // followed by the instance ID
+	END_INSTANCE_SYMBOL string = "E" // followed by the instance ID
+	END_OUTCOME_SYMBOL string = "O" // followed by the instance ID and the outcome
+	LABEL_SYMBOL string = "L" // followed by the instance ID and its labels
+	LAP_SYMBOL string = "P" // followed by the instance ID and the NUL-terminated lap name
+	HEADER_SYMBOL string = "H" // has the host in place of the name, and is followed by the PID as a uint32
+	LEN_TYPE_SYMBOL int = 1 // all symbols have this length
+	)
+
+/** How a timer came to be ended. Plain ends have OUTCOME_NONE. */
+type Outcome byte
+
+const (
+	OUTCOME_NONE Outcome = 0
+	OUTCOME_CANCELLED Outcome = 1 // ended because its context was cancelled
+	OUTCOME_SUCCESS Outcome = 2
+	OUTCOME_ERROR Outcome = 3
+	OUTCOME_PANIC Outcome = 4
+	OUTCOME_STALE Outcome = 5 // ended by the watchdog
 	)
 
-/** Name can't contain \0. */
+func (o Outcome) String() string {
+	switch o {
+	case OUTCOME_NONE:
+		return "none"
+	case OUTCOME_CANCELLED:
+		return "cancelled"
+	case OUTCOME_SUCCESS:
+		return "success"
+	case OUTCOME_ERROR:
+		return "error"
+	case OUTCOME_PANIC:
+		return "panic"
+	case OUTCOME_STALE:
+		return "stale"
+	default:
+		return fmt.Sprintf("outcome(%d)", byte(o))
+	}
+}
+
+/** A single entry in a log file: the timer name, a NUL, the type symbol and
+    the time. Instance records additionally carry the instance ID. */
+type logRecord struct {
+	name string
+	symbol string
+	time int64
+	id uint64
+	outcome Outcome
+	labels Labels
+	lap string
+	pid int
+}
+
+func (rec *logRecord) encode() []byte {
+	var buf *bytes.Buffer = bytes.NewBuffer(make([]byte, 0, len(rec.name) + 1 + LEN_TYPE_SYMBOL + 16))
+	buf.WriteString(rec.name)
+	buf.WriteByte(0)
+	buf.WriteString(rec.symbol)
+	binary.Write(buf, binary.LittleEndian, rec.time)
+	switch rec.symbol {
+	case START_INSTANCE_SYMBOL, END_INSTANCE_SYMBOL:
+		binary.Write(buf, binary.LittleEndian, rec.id)
+	case END_OUTCOME_SYMBOL:
+		binary.Write(buf, binary.LittleEndian, rec.id)
+		buf.WriteByte(byte(rec.outcome))
+	case LABEL_SYMBOL:
+		binary.Write(buf, binary.LittleEndian, rec.id)
+		buf.Write(rec.labels.encode())
+	case LAP_SYMBOL:
+		binary.Write(buf, binary.LittleEndian, rec.id)
+		buf.WriteString(rec.lap)
+		buf.WriteByte(0)
+	case HEADER_SYMBOL:
+		binary.Write(buf, binary.LittleEndian, uint32(rec.pid))
+	}
+	return buf.Bytes()
+}
+
+/** Returns io.EOF only if the reader ends cleanly between records. */
+func readRecord(freader *bufio.Reader) (*logRecord, error) {
+	name, err := freader.ReadString('\x00')
+	if err != nil {
+		return nil, err
+	}
+	var rec *logRecord = &logRecord{name: name[:len(name) - 1]}
+	var buf []byte = make([]byte, LEN_TYPE_SYMBOL)
+	_, err = io.ReadFull(freader, buf)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	rec.symbol = string(buf)
+	err = binary.Read(freader, binary.LittleEndian, &rec.time)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch rec.symbol {
+	case START_SYMBOL, END_SYMBOL:
+	case START_INSTANCE_SYMBOL, END_INSTANCE_SYMBOL:
+		err = binary.Read(freader, binary.LittleEndian, &rec.id)
+	case END_OUTCOME_SYMBOL:
+		err = binary.Read(freader, binary.LittleEndian, &rec.id)
+		if err == nil {
+			err = binary.Read(freader, binary.LittleEndian, &rec.outcome)
+		}
+	case LABEL_SYMBOL:
+		err = binary.Read(freader, binary.LittleEndian, &rec.id)
+		if err == nil {
+			rec.labels, err = readLabels(freader)
+		}
+	case LAP_SYMBOL:
+		err = binary.Read(freader, binary.LittleEndian, &rec.id)
+		if err == nil {
+			rec.lap, err = freader.ReadString('\x00')
+		}
+		if err == nil {
+			rec.lap = rec.lap[:len(rec.lap) - 1]
+		}
+	case HEADER_SYMBOL:
+		var pid uint32
+		err = binary.Read(freader, binary.LittleEndian, &pid)
+		rec.pid = int(pid)
+	default:
+		err = fmt.Errorf("unknown record type %q for timer %s", rec.symbol, rec.name)
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return rec, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+/** Name can't contain \0. The timer can't be labelled; see StartLabelledLogTimer. */
 func StartLogTimer(name string) {
 	logEvent(name, START_SYMBOL)
 }
@@ -225,15 +854,89 @@ func EndLogTimer(name string) {
 type TimerSummary struct {
 	starts []int64
 	ends []int64
+	instances map[uint64]*timerInstance // events from handles, paired by ID rather than position
+}
+
+type timerInstance struct {
+	start int64
+	end int64
+	started bool
+	ended bool
+	outcome Outcome
+	labels Labels
+	laps []Lap // splits are filled in by splitLaps
+	source string // the log file the instance was started in, if parsed from one
+	pid int // from the log header, or from the file timer
+	host string
+}
+
+func newTimerSummary(capacity int) *TimerSummary {
+	return &TimerSummary{make([]int64, 0, capacity), make([]int64, 0, capacity), nil}
+}
+
+func (summary *TimerSummary) getInstance(id uint64) *timerInstance {
+	if summary.instances == nil {
+		summary.instances = make(map[uint64]*timerInstance)
+	}
+	inst, ok := summary.instances[id]
+	if !ok {
+		inst = &timerInstance{}
+		summary.instances[id] = inst
+	}
+	return inst
+}
+
+func applyRecord(summary *TimerSummary, rec *logRecord) {
+	var inst *timerInstance
+	switch rec.symbol {
+	case START_SYMBOL:
+		summary.starts = append(summary.starts, rec.time)
+	case END_SYMBOL:
+		summary.ends = append(summary.ends, rec.time)
+	case START_INSTANCE_SYMBOL:
+		inst = summary.getInstance(rec.id)
+		inst.start = rec.time
+		inst.started = true
+	case END_INSTANCE_SYMBOL, END_OUTCOME_SYMBOL:
+		inst = summary.getInstance(rec.id)
+		inst.end = rec.time
+		inst.ended = true
+		inst.outcome = rec.outcome
+	case LABEL_SYMBOL:
+		inst = summary.getInstance(rec.id)
+		if inst.labels == nil {
+			inst.labels = make(Labels)
+		}
+		inst.labels.merge(rec.labels)
+	case LAP_SYMBOL:
+		inst = summary.getInstance(rec.id)
+		inst.laps = append(inst.laps, Lap{Name: rec.lap, Time: rec.time})
+	}
+}
+
+/** Calls handle for each record in the file, panicking if it can't be read. */
+func readLogFile(fname string, handle func(*logRecord)) {
+	f, err := os.Open(fname)
+	if err != nil {
+		panic(fmt.Sprintf("Attempted to parse file at invalid filepath %s", fname))
+	}
+	var freader *bufio.Reader = bufio.NewReader(f)
+	rec, err := readRecord(freader)
+	for err != io.EOF {
+		checkerr(f, fname, err)
+		handle(rec)
+		rec, err = readRecord(freader)
+	}
+	f.Close()
 }
 
 func checkerr(f *os.File, filename string, err error) {
 	if err != nil {
 		f.Close()
-		if err == io.EOF {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			panic(fmt.Sprintf("Unexpected end of file when parsing %s", filename))
 		} else {
-			panic(fmt.Sprintf("Could not read file at filepath %s", filename))
+			panic(fmt.Sprintf("Could not read file at filepath %s: %v", filename, err))
 		}
 	}
 }
@@ -253,12 +956,9 @@ func ParseFileToMap(filenames []string) map[string]*TimerSummary {
 		}
 	}
 	var tmap map[string]*TimerSummary = make(map[string]*TimerSummary)
-	var buf []byte = make([]byte, LEN_TYPE_SYMBOL, LEN_TYPE_SYMBOL)
-	var name string
-	var frag2 string
+	var rec *logRecord
 	var summary *TimerSummary
 	var ok bool
-	var time int64
 	var freader *bufio.Reader
 	var fname string
 	
@@ -270,92 +970,200 @@ func ParseFileToMap(filenames []string) map[string]*TimerSummary {
 			panic(fmt.Sprintf("Attempted to parse file at invalid filepath %s", fname))
 		}
 		freader = bufio.NewReader(f)
-		name, err = freader.ReadString('\x00')
+		var origin *timerInstance = &timerInstance{source: fname}
+		rec, err = readRecord(freader)
 		for err != io.EOF {
-			name = name[:len(name) - 1]
-			_, err = freader.Read(buf)
-			checkerr(f, fname, err)
-			frag2 = string(buf)
-			err = binary.Read(freader, binary.LittleEndian, &time)
 			checkerr(f, fname, err)
-			summary, ok = tmap[name]
-			if !ok {
-				summary = &TimerSummary{make([]int64, 0, 1), make([]int64, 0, 1)}
-				tmap[name] = summary
-			}
-			if frag2 == START_SYMBOL {
-				summary.starts = append(summary.starts, time)
+			if rec.symbol == HEADER_SYMBOL {
+				origin.host, origin.pid = rec.name, rec.pid
 			} else {
-				summary.ends = append(summary.ends, time)
+				summary, ok = tmap[rec.name]
+				if !ok {
+					summary = newTimerSummary(1)
+					tmap[rec.name] = summary
+				}
+				applyRecord(summary, rec)
+				attributeRecord(summary, rec, origin)
 			}
-			name, err = freader.ReadString('\x00')
+			rec, err = readRecord(freader)
 		}
 		f.Close()
 	}
 	return tmap
 }
 
+/** Records which file, host and process an instance was started in, or ended
+    in if its start hasn't been seen. */
+func attributeRecord(summary *TimerSummary, rec *logRecord, origin *timerInstance) {
+	if rec.id == 0 {
+		return
+	}
+	var inst *timerInstance = summary.getInstance(rec.id)
+	if inst.source == "" || rec.symbol == START_INSTANCE_SYMBOL {
+		inst.source, inst.host, inst.pid = origin.source, origin.host, origin.pid
+	}
+}
+
 func ParseMapToDeltas(tmap map[string]*TimerSummary) map[string][]int64 {
 	var tname string
 	var tsummary *TimerSummary
 	var deltamap map[string][]int64 = make(map[string][]int64)
-	var i int
-	
 	var deltas []int64
+	var instances []*timerInstance
 	
-	TimerLoop:
-		for tname, tsummary = range tmap {
-			if len(tsummary.starts) == 0 {
-				fmt.Printf("Timer %s was ended but never started\n", tname)
-				continue
-			} else if len(tsummary.ends) == 0 {
-				fmt.Printf("Timer %s was started but never ended\n", tname)
-				continue
-			} else if len(tsummary.starts) != len(tsummary.ends) {
-				fmt.Printf("Timer %s has a different number of starts than ends\n", tname)
-				continue
-			}
-			deltas = make([]int64, len(tsummary.starts))
-			for i = 0; i < len(tsummary.ends); i++ {
-				if tsummary.starts[i] > tsummary.ends[i] {
-					fmt.Printf("Timer %s has an end time preceding start time\n", tname)
-					continue TimerLoop
-				}
-				if i > 0 && tsummary.starts[i] < tsummary.ends[i - 1] {
-					fmt.Printf("Timer %s was started twice without being ended in between\n", tname)
-					continue TimerLoop
-				}
-				deltas[i] = tsummary.ends[i] - tsummary.starts[i]
-			}
+	for tname, tsummary = range tmap {
+		deltas = positionalDeltas(tname, tsummary)
+		instances = completeInstances(tname, tsummary)
+		for _, inst := range instances {
+			deltas = append(deltas, inst.end - inst.start)
+		}
+		if len(deltas) != 0 {
 			deltamap[tname] = deltas
 		}
+	}
 		
 	return deltamap
 }
 
+/** Something in a log that stops a start and an end from being paired. ID is 0
+    for starts and ends that have no instance ID. */
+type Anomaly struct {
+	Name string
+	ID uint64
+	Message string
+}
+
+func (a Anomaly) String() string {
+	if a.ID == 0 {
+		return fmt.Sprintf("Timer %s %s", a.Name, a.Message)
+	}
+	return fmt.Sprintf("Timer %s instance %d %s", a.Name, a.ID, a.Message)
+}
+
+func printAnomaly(a Anomaly) {
+	fmt.Println(a)
+}
+
+var anomalyReporter func(Anomaly) = printAnomaly
+
+/** Sets where parsing sends anomalies; by default they are printed to stdout.
+    A nil reporter discards them. Like SetLogFile, this is meant to be called
+    once at startup, e.g. to send anomalies to stderr or a logger. */
+func SetAnomalyReporter(report func(Anomaly)) {
+	if report == nil {
+		report = func (Anomaly) {}
+	}
+	anomalyReporter = report
+}
+
+func reportAnomaly(a Anomaly) {
+	anomalyReporter(a)
+}
+
+func positionalDeltas(tname string, tsummary *TimerSummary) []int64 {
+	return pairPositional(tname, tsummary, reportAnomaly)
+}
+
+/** Pairs the starts and ends that have no instance ID by position. Any anomaly
+    discards all of them. */
+func pairPositional(tname string, tsummary *TimerSummary, report func(Anomaly)) []int64 {
+	if len(tsummary.starts) == 0 && len(tsummary.ends) == 0 {
+		return nil
+	} else if len(tsummary.starts) == 0 {
+		report(Anomaly{tname, 0, "was ended but never started"})
+		return nil
+	} else if len(tsummary.ends) == 0 {
+		report(Anomaly{tname, 0, "was started but never ended"})
+		return nil
+	} else if len(tsummary.starts) != len(tsummary.ends) {
+		report(Anomaly{tname, 0, "has a different number of starts than ends"})
+		return nil
+	}
+	var deltas []int64 = make([]int64, len(tsummary.starts))
+	for i := 0; i < len(tsummary.ends); i++ {
+		if tsummary.starts[i] > tsummary.ends[i] {
+			report(Anomaly{tname, 0, "has an end time preceding start time"})
+			return nil
+		}
+		if i > 0 && tsummary.starts[i] < tsummary.ends[i - 1] {
+			report(Anomaly{tname, 0, "was started twice without being ended in between"})
+			return nil
+		}
+		deltas[i] = tsummary.ends[i] - tsummary.starts[i]
+	}
+	return deltas
+}
+
+/** Instances are paired by ID, so they may overlap freely. A bad instance is
+    reported and skipped without discarding the rest of the timer. The result is
+    ordered by start time. */
+func completeInstances(tname string, tsummary *TimerSummary) []*timerInstance {
+	var ids []uint64 = completeInstanceIDs(tname, tsummary)
+	var complete []*timerInstance = make([]*timerInstance, len(ids))
+	for i, id := range ids {
+		complete[i] = tsummary.instances[id]
+	}
+	return complete
+}
+
+func completeInstanceIDs(tname string, tsummary *TimerSummary) []uint64 {
+	return pairInstances(tname, tsummary, reportAnomaly)
+}
+
+func pairInstances(tname string, tsummary *TimerSummary, report func(Anomaly)) []uint64 {
+	var ids []uint64 = make([]uint64, 0, len(tsummary.instances))
+	for id := range tsummary.instances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func (i int, j int) bool { return ids[i] < ids[j] })
+	var complete []uint64 = make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		var inst *timerInstance = tsummary.instances[id]
+		if !inst.started {
+			report(Anomaly{tname, id, "was ended but never started"})
+		} else if !inst.ended {
+			report(Anomaly{tname, id, "was started but never ended"})
+		} else if inst.start > inst.end {
+			report(Anomaly{tname, id, "has an end time preceding start time"})
+		} else {
+			complete = append(complete, id)
+		}
+	}
+	sort.SliceStable(complete, func (i int, j int) bool {
+		return tsummary.instances[complete[i]].start < tsummary.instances[complete[j]].start
+	})
+	return complete
+}
+
 /* BUFFERED LOG TIMER 
    An in-memory version of the log-based timer. Can be serialized to a log file. */
 
 var bufferedTimers map[string]*TimerSummary = make(map[string]*TimerSummary)
+var bufferLock sync.Mutex
 
 func getSummary(name string) (summary *TimerSummary) {
 	var exists bool
 	summary, exists = bufferedTimers[name]
 	if !exists {
-		summary = &TimerSummary{make([]int64, 0, 7), make([]int64, 0, 7)}
+		summary = newTimerSummary(7)
 		bufferedTimers[name] = summary
 	}
 	return
 }
 
+func bufferRecord(rec *logRecord) {
+	bufferLock.Lock()
+	defer bufferLock.Unlock()
+	applyRecord(getSummary(rec.name), rec)
+}
+
+/** The timer can't be labelled; see StartLabelledBufferedLogTimer. */
 func StartBufferedLogTimer(name string) {
-	var summary *TimerSummary = getSummary(name)
-	summary.starts = append(summary.starts, time.Now().UnixNano())
+	bufferRecord(&logRecord{name: name, symbol: START_SYMBOL, time: time.Now().UnixNano()})
 }
 
 func EndBufferedLogTimer(name string) {
-	var summary *TimerSummary = getSummary(name)
-	summary.ends = append(summary.ends, time.Now().UnixNano())
+	bufferRecord(&logRecord{name: name, symbol: END_SYMBOL, time: time.Now().UnixNano()})
 }
 
 func writeArray(writer io.Writer, array []int64, name string, symbol string) error {
@@ -373,9 +1181,85 @@ func writeArray(writer io.Writer, array []int64, name string, symbol string) err
 	return nil
 }
 
-func WriteLogBuffer(writer io.Writer) error {
+func writeInstances(writer io.Writer, instances map[uint64]*timerInstance, name string) error {
+	var ids []uint64 = make([]uint64, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func (i int, j int) bool { return ids[i] < ids[j] })
 	var err error
+	for _, id := range ids {
+		err = writeInstance(writer, name, id, instances[id])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeInstance(writer io.Writer, name string, id uint64, inst *timerInstance) error {
+	var records []*logRecord = make([]*logRecord, 0, 3 + len(inst.laps))
+	if inst.started {
+		records = append(records, &logRecord{name: name, symbol: START_INSTANCE_SYMBOL, time: inst.start, id: id})
+	}
+	if len(inst.labels) != 0 {
+		records = append(records, &logRecord{name: name, symbol: LABEL_SYMBOL, time: inst.start, id: id, labels: inst.labels})
+	}
+	for _, lap := range inst.laps {
+		records = append(records, &logRecord{name: name, symbol: LAP_SYMBOL, time: lap.Time, id: id, lap: lap.Name})
+	}
+	if inst.ended {
+		records = append(records, endRecord(name, inst.end, id, inst.outcome))
+	}
+	var err error
+	for _, rec := range records {
+		_, err = writer.Write(rec.encode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func endRecord(name string, t int64, id uint64, outcome Outcome) *logRecord {
+	if outcome == OUTCOME_NONE {
+		return &logRecord{name: name, symbol: END_INSTANCE_SYMBOL, time: t, id: id}
+	}
+	return &logRecord{name: name, symbol: END_OUTCOME_SYMBOL, time: t, id: id, outcome: outcome}
+}
+
+/** Copies what WriteLogBuffer writes, so that it can be written out without
+    holding bufferLock. Starts, ends and laps are only ever appended to, so the
+    slices can be shared as they are; an instance's other fields and its labels
+    can still change, so those are copied. */
+func snapshotLogBuffer() map[string]*TimerSummary {
+	bufferLock.Lock()
+	defer bufferLock.Unlock()
+	var snapshot map[string]*TimerSummary = make(map[string]*TimerSummary, len(bufferedTimers))
 	for name, summary := range bufferedTimers {
+		var instances map[uint64]*timerInstance = make(map[uint64]*timerInstance, len(summary.instances))
+		for id, inst := range summary.instances {
+			var copied timerInstance = *inst
+			if inst.labels != nil {
+				copied.labels = make(Labels, len(inst.labels))
+				copied.labels.merge(inst.labels)
+			}
+			instances[id] = &copied
+		}
+		snapshot[name] = &TimerSummary{summary.starts, summary.ends, instances}
+	}
+	return snapshot
+}
+
+/** The buffer is copied before it is written, so a slow writer doesn't hold up
+    the buffered log timers. */
+func WriteLogBuffer(writer io.Writer) error {
+	var snapshot map[string]*TimerSummary = snapshotLogBuffer()
+	_, err := writer.Write(headerRecord().encode())
+	if err != nil {
+		return err
+	}
+	for name, summary := range snapshot {
 		err = writeArray(writer, summary.starts, name, START_SYMBOL)
 		if err != nil {
 			return err
@@ -384,6 +1268,10 @@ func WriteLogBuffer(writer io.Writer) error {
 		if err != nil {
 			return err
 		}
+		err = writeInstances(writer, summary.instances, name)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -393,9 +1281,13 @@ func GetLogBuffer() map[string]*TimerSummary {
 }
 
 func ResetLogBuffer() {
+	bufferLock.Lock()
 	bufferedTimers = make(map[string]*TimerSummary)
+	bufferLock.Unlock()
 }
 
 func SetLogBuffer(newbuffer map[string]*TimerSummary) {
+	bufferLock.Lock()
 	bufferedTimers = newbuffer
+	bufferLock.Unlock()
 }
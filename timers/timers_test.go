@@ -1,7 +1,9 @@
 package timers
 
+import "io/ioutil"
 import "os"
 import "runtime"
+import "strings"
 import "testing"
 
 func expFibonacci(n uint64) uint64 {
@@ -307,6 +309,78 @@ func TestFileTimers6(t *testing.T) {
 	DeleteFileTimer("t1")
 }
 
+func TestFileTimers7(t *testing.T) {
+	if _, err := GetFileTimerStart("t1"); err != ErrFileTimerMissing {
+		t.Logf("Missing timer gave %v", err)
+		t.Fail()
+	}
+	StartFileTimer("t1")
+	EndFileTimer("t1")
+	entries, _ := ioutil.ReadDir("/home/sam/timers")
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".t1.") {
+			t.Logf("Temporary file %s left behind", entry.Name())
+			t.Fail()
+		}
+	}
+	ioutil.WriteFile("/home/sam/timers/t1.timer", []byte("{\"format\": \"go-timers/file-ti"), 0644)
+	if _, err := GetFileTimerEnd("t1"); err != ErrFileTimerCorrupt {
+		t.Logf("Truncated timer gave %v", err)
+		t.Fail()
+	}
+	if delta := GetFileTimerDelta("t1"); delta != -3 {
+		t.Logf("Truncated timer has delta %v", delta)
+		t.Fail()
+	}
+	DeleteFileTimer("t1")
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteFileTimer("t1")
+		}()
+	ioutil.WriteFile("/home/sam/timers/t1_start", []byte{}, 0644)
+	finished = true
+	PollFileTimer("t1")
+}
+
+func TestFileTimers8(t *testing.T) {
+	SetFileTimerStrict(true)
+	defer SetFileTimerStrict(false)
+	var started chan bool = make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func () {
+				defer func () {
+						started <- recover() == nil
+					}()
+				StartFileTimer("t1")
+			}()
+	}
+	var successes int = 0
+	for i := 0; i < 8; i++ {
+		if <-started {
+			successes++
+		}
+	}
+	if successes != 1 {
+		t.Logf("Strict timer was started %v times", successes)
+		t.Fail()
+	}
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+			DeleteFileTimer("t1")
+		}()
+	EndFileTimer("t1")
+	finished = true
+	EndFileTimer("t1")
+}
+
 func TestLogTimers1(t *testing.T) {
 	SetLogFile("/home/sam/timers/logtimer1")
 	StartLogTimer("fastfib")
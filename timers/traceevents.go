@@ -0,0 +1,170 @@
+package timers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	)
+
+/* CHROME TRACE EVENTS
+   Writes intervals in the Trace Event Format read by chrome://tracing and
+   Perfetto, as a "B" and an "E" event each. Each log file, or each process
+   where one was recorded, becomes a trace process. Within a process, intervals
+   are spread over as few threads ("lanes") as possible such that the
+   intervals on each lane nest, since B and E events on a thread must. */
+
+type traceEvent struct {
+	Name string `json:"name"`
+	Cat string `json:"cat,omitempty"`
+	Ph string `json:"ph"`
+	Ts json.Number `json:"ts"`
+	Pid int `json:"pid"`
+	Tid int `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+type traceProcess struct {
+	pid int
+	name string
+	intervals []Interval
+}
+
+/** Trace timestamps are in microseconds; the nanoseconds are kept as decimals. */
+func traceTimestamp(nanos int64) json.Number {
+	var sign string = ""
+	if nanos < 0 {
+		sign, nanos = "-", -nanos
+	}
+	return json.Number(fmt.Sprintf("%s%d.%03d", sign, nanos / 1000, nanos % 1000))
+}
+
+/** Groups intervals by log file and process. Recorded PIDs are kept unless an
+    earlier group has taken them; the rest are numbered from 1, skipping any
+    PID already in use. */
+func traceProcesses(intervals []Interval) []*traceProcess {
+	var byKey map[string]*traceProcess = make(map[string]*traceProcess)
+	var processes []*traceProcess
+	var used map[int]bool = make(map[int]bool)
+	for _, interval := range intervals {
+		var key string = fmt.Sprintf("%s\x00%s\x00%d", interval.Source, interval.Host, interval.PID)
+		process, ok := byKey[key]
+		if !ok {
+			process = &traceProcess{name: interval.Source}
+			if interval.Host != "" {
+				process.name = fmt.Sprintf("%s (pid %d)", interval.Host, interval.PID)
+				if interval.Source != "" {
+					process.name += ": " + interval.Source
+				}
+			}
+			if interval.PID != 0 && !used[interval.PID] {
+				process.pid = interval.PID
+				used[interval.PID] = true
+			}
+			byKey[key] = process
+			processes = append(processes, process)
+		}
+		process.intervals = append(process.intervals, interval)
+	}
+	var next int = 1
+	for _, process := range processes {
+		if process.pid == 0 {
+			for used[next] {
+				next++
+			}
+			process.pid = next
+			used[next] = true
+		}
+	}
+	return processes
+}
+
+/** Assigns each interval the first lane on which it nests inside whatever is
+    still open. intervals must be ordered by start, longest first on ties. */
+func assignLanes(intervals []Interval) [][]Interval {
+	var lanes [][]Interval
+	var open [][]int64 // the ends of the intervals still open on each lane
+	for _, interval := range intervals {
+		var lane int = -1
+		for i := range lanes {
+			for len(open[i]) > 0 && open[i][len(open[i]) - 1] <= interval.Start {
+				open[i] = open[i][:len(open[i]) - 1]
+			}
+			if len(open[i]) == 0 || open[i][len(open[i]) - 1] >= interval.End {
+				lane = i
+				break
+			}
+		}
+		if lane == -1 {
+			lanes = append(lanes, nil)
+			open = append(open, nil)
+			lane = len(lanes) - 1
+		}
+		lanes[lane] = append(lanes[lane], interval)
+		open[lane] = append(open[lane], interval.End)
+	}
+	return lanes
+}
+
+func laneEvents(intervals []Interval, pid int, tid int) []traceEvent {
+	var events []traceEvent = make([]traceEvent, 0, 2 * len(intervals))
+	var stack []Interval
+	var end = func () {
+		var top Interval = stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+		events = append(events, traceEvent{Name: top.Name, Cat: "timer", Ph: "E", Ts: traceTimestamp(top.End), Pid: pid, Tid: tid})
+	}
+	for _, interval := range intervals {
+		for len(stack) > 0 && stack[len(stack) - 1].End <= interval.Start {
+			end()
+		}
+		var args map[string]string = make(map[string]string)
+		for k, v := range interval.Labels {
+			args[k] = v
+		}
+		if interval.Outcome != OUTCOME_NONE {
+			args["outcome"] = interval.Outcome.String()
+		}
+		if len(args) == 0 {
+			args = nil
+		}
+		events = append(events, traceEvent{interval.Name, "timer", "B", traceTimestamp(interval.Start), pid, tid, args})
+		stack = append(stack, interval)
+	}
+	for len(stack) > 0 {
+		end()
+	}
+	return events
+}
+
+func WriteTraceEvents(writer io.Writer, intervals []Interval) error {
+	var sorted []Interval = append([]Interval(nil), intervals...)
+	sort.SliceStable(sorted, func (i int, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].End > sorted[j].End
+	})
+	var events []traceEvent = make([]traceEvent, 0, 2 * len(sorted))
+	for _, process := range traceProcesses(sorted) {
+		if process.name != "" {
+			events = append(events, traceEvent{Name: "process_name", Ph: "M", Ts: "0", Pid: process.pid, Args: map[string]string{"name": process.name}})
+		}
+		for i, lane := range assignLanes(process.intervals) {
+			events = append(events, laneEvents(lane, process.pid, i + 1)...)
+		}
+	}
+	return json.NewEncoder(writer).Encode(map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ns"})
+}
+
+/** Each log file becomes its own trace process. */
+func WriteLogTraceEvents(writer io.Writer, filenames []string) error {
+	return WriteTraceEvents(writer, ParseFilesToIntervals(filenames))
+}
+
+func WriteBufferedLogTraceEvents(writer io.Writer) error {
+	bufferLock.Lock()
+	var intervals []Interval = ParseMapToIntervals(bufferedTimers)
+	bufferLock.Unlock()
+	return WriteTraceEvents(writer, intervals)
+}
@@ -0,0 +1,89 @@
+package timers
+
+import "bytes"
+import "encoding/json"
+import "os"
+import "testing"
+
+type traceTestFile struct {
+	TraceEvents []traceEvent `json:"traceEvents"`
+}
+
+func TestTraceEvents1(t *testing.T) {
+	var lanes [][]Interval = assignLanes([]Interval{
+		Interval{Name: "outer", Start: 0, End: 100},
+		Interval{Name: "inner", Start: 10, End: 50},
+		Interval{Name: "overlap", Start: 40, End: 120},
+		Interval{Name: "inner2", Start: 60, End: 70},
+		Interval{Name: "after", Start: 100, End: 110},
+	})
+	if len(lanes) != 2 || len(lanes[0]) != 4 || lanes[1][0].Name != "overlap" {
+		t.Logf("Bad lanes %v", lanes)
+		t.Fail()
+	}
+	var processes []*traceProcess = traceProcesses([]Interval{
+		Interval{Name: "a", Source: "log1", Host: "h", PID: 7},
+		Interval{Name: "b", Source: "log2", Host: "h", PID: 7},
+		Interval{Name: "c", Source: "log3"},
+	})
+	if len(processes) != 3 || processes[0].pid != 7 || processes[1].pid == 7 || processes[2].pid == processes[1].pid ||
+		processes[1].name != "h (pid 7): log2" {
+		t.Log("Processes sharing a recorded PID were not told apart")
+		t.Fail()
+	}
+	if traceTimestamp(1234567) != "1234.567" || traceTimestamp(5) != "0.005" {
+		t.Log("Bad timestamps")
+		t.Fail()
+	}
+}
+
+func TestTraceEvents2(t *testing.T) {
+	SetLogFile("/home/sam/timers/tracelog1")
+	var outer *Handle = StartLogHandle("outer")
+	var inner1 *Handle = StartLogHandle("inner")
+	var inner2 *Handle = StartLogHandle("inner")
+	inner1.EndWithLabels(Labels{"k": "v"})
+	inner2.End()
+	outer.End()
+	CloseLogFile()
+	SetLogFile("/home/sam/timers/tracelog2")
+	StartLogTimer("other")
+	EndLogTimer("other")
+	CloseLogFile()
+	var buf bytes.Buffer
+	if err := WriteLogTraceEvents(&buf, []string{"/home/sam/timers/tracelog1", "/home/sam/timers/tracelog2"}); err != nil {
+		t.Logf("Export failed: %v", err)
+		t.Fail()
+	}
+	var trace traceTestFile
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Logf("Bad JSON: %v", err)
+		t.Fail()
+		return
+	}
+	var begins, ends, meta int = 0, 0, 0
+	var tids map[int]bool = make(map[int]bool)
+	var pids map[int]bool = make(map[int]bool)
+	for _, event := range trace.TraceEvents {
+		switch event.Ph {
+		case "B":
+			begins++
+			tids[event.Tid] = true
+			pids[event.Pid] = true
+		case "E":
+			ends++
+		case "M":
+			meta++
+		}
+	}
+	if begins != 4 || ends != 4 || meta != 2 || len(pids) != 2 || len(tids) != 2 {
+		t.Logf("Bad events %v", trace.TraceEvents)
+		t.Fail()
+	}
+	if trace.TraceEvents[1].Name != "outer" || trace.TraceEvents[1].Ph != "B" {
+		t.Logf("Outer timer does not open its lane: %v", trace.TraceEvents[1])
+		t.Fail()
+	}
+	os.Remove("/home/sam/timers/tracelog1")
+	os.Remove("/home/sam/timers/tracelog2")
+}
@@ -0,0 +1,145 @@
+package timers
+
+import (
+	"fmt"
+	"log"
+	"time"
+	)
+
+/* WATCHDOG
+   Finds hashtable and file timers that have been running for too long, which
+   usually means the code that should have ended them never ran. */
+
+const (
+	BACKEND_HASHTABLE string = "hashtable"
+	BACKEND_FILE string = "file"
+	)
+
+const (
+	WATCHDOG_REPORT int = iota // only report stale timers
+	WATCHDOG_END // end stale timers with OUTCOME_STALE
+	WATCHDOG_DELETE // delete stale timers
+	)
+
+type StaleTimer struct {
+	Backend string
+	Name string
+	Age int64 // wall-clock time since the timer was started
+}
+
+type WatchdogConfig struct {
+	Threshold time.Duration
+	Interval time.Duration // between checks; defaults to Threshold
+	Files bool // also check the current file timer collection
+	Action int
+	Callback func(StaleTimer) // called once per stale timer per check; nil logs instead
+}
+
+/** Checks once and returns the stale timers found, after reporting them and
+    applying the configured action. */
+func CheckStaleTimers(config WatchdogConfig) []StaleTimer {
+	var now int64 = time.Now().UnixNano()
+	var stale []StaleTimer = make([]StaleTimer, 0)
+	var timer StaleTimer
+	for _, info := range ListTimers() {
+		timer = StaleTimer{BACKEND_HASHTABLE, info.Name, now - info.Start}
+		if info.State != STATE_ENDED && timer.Age > int64(config.Threshold) && handleStaleTimer(config, timer, info.Start) {
+			stale = append(stale, timer)
+		}
+	}
+	if config.Files {
+		for _, info := range ListFileTimers() {
+			timer = StaleTimer{BACKEND_FILE, info.Name, now - info.Start}
+			if info.State == STATE_RUNNING && timer.Age > int64(config.Threshold) && handleStaleTimer(config, timer, info.Start) {
+				stale = append(stale, timer)
+			}
+		}
+	}
+	return stale
+}
+
+/** Returns false if the timer was ended or restarted since it was listed. */
+func handleStaleTimer(config WatchdogConfig, timer StaleTimer, start int64) bool {
+	if timer.Backend == BACKEND_HASHTABLE {
+		timersLock.Lock()
+		if timers[timer.Name] != start {
+			timersLock.Unlock()
+			return false
+		}
+		if _, ok := timersEnd[timer.Name]; ok {
+			timersLock.Unlock()
+			return false
+		}
+		switch config.Action {
+		case WATCHDOG_END:
+			endTimer(timer.Name)
+			timersOutcome[timer.Name] = OUTCOME_STALE
+		case WATCHDOG_DELETE:
+			deleteTimer(timer.Name)
+		}
+		timersLock.Unlock()
+	} else if config.Action != WATCHDOG_REPORT {
+		if !settleFileTimer(timer.Name, start, OUTCOME_STALE, config.Action == WATCHDOG_DELETE) {
+			return false
+		}
+	}
+	if config.Callback != nil {
+		config.Callback(timer)
+	} else {
+		log.Printf("Timer %s (%s) has been running for %v", timer.Name, timer.Backend, time.Duration(timer.Age))
+	}
+	return true
+}
+
+type Watchdog struct {
+	stop chan bool
+	done chan bool
+}
+
+/** Checks for stale timers in the background until Stop is called. Panics if
+    neither Interval nor Threshold is positive, or if Files is set without a
+    file timer collection. */
+func StartWatchdog(config WatchdogConfig) *Watchdog {
+	var interval time.Duration = config.Interval
+	if interval <= 0 {
+		interval = config.Threshold
+	}
+	if interval <= 0 {
+		panic(fmt.Sprintf("Attempted to start watchdog with interval %v and threshold %v", config.Interval, config.Threshold))
+	}
+	if config.Files && timerDir == "" {
+		panic("Attempted to start watchdog on file timers without a Timer collection")
+	}
+	var w *Watchdog = &Watchdog{make(chan bool), make(chan bool)}
+	go func () {
+		var ticker *time.Ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		defer close(w.done)
+		for {
+			select {
+			case <-ticker.C:
+				watchdogCheck(config)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+/** A check that panics, e.g. because the collection's directory was removed or
+    the callback panicked, is logged rather than taking down the process. */
+func watchdogCheck(config WatchdogConfig) {
+	defer func () {
+		if r := recover(); r != nil {
+			log.Printf("Watchdog check failed: %v", r)
+		}
+	}()
+	CheckStaleTimers(config)
+}
+
+/** Waits for a check in progress to finish. */
+func (w *Watchdog) Stop() {
+	close(w.stop)
+	<-w.done
+}
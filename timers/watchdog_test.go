@@ -0,0 +1,118 @@
+package timers
+
+import "sync/atomic"
+import "testing"
+import "time"
+
+func TestWatchdog1(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	StartTimer("t1")
+	StartTimer("t2")
+	EndTimer("t2")
+	StartFileTimer("watched")
+	time.Sleep(20 * time.Millisecond)
+	StartTimer("t3")
+	var reported []StaleTimer
+	var stale []StaleTimer
+	for _, timer := range CheckStaleTimers(WatchdogConfig{
+			Threshold: 10 * time.Millisecond,
+			Files: true,
+			Callback: func (timer StaleTimer) { reported = append(reported, timer) },
+		}) {
+		if timer.Backend == BACKEND_HASHTABLE || timer.Name == "watched" { // ignore file timers left by other tests
+			stale = append(stale, timer)
+		}
+	}
+	if len(stale) != 2 || len(reported) < 2 {
+		t.Logf("Bad stale timers %v", stale)
+		t.Fail()
+	} else if stale[0].Name != "t1" || stale[0].Backend != BACKEND_HASHTABLE || stale[1].Name != "watched" || stale[1].Backend != BACKEND_FILE {
+		t.Logf("Bad stale timers %v", stale)
+		t.Fail()
+	} else if stale[0].Age < int64(20 * time.Millisecond) {
+		t.Fail()
+	}
+	if GetTimerDelta("t1") != -2 {
+		t.Log("Reporting ended the timer")
+		t.Fail()
+	}
+	DeleteTimer("t1")
+	DeleteTimer("t2")
+	DeleteTimer("t3")
+	DeleteFileTimer("watched")
+}
+
+func TestWatchdog2(t *testing.T) {
+	SetFileTimerCollection("/home/sam/timers")
+	StartTimer("t1")
+	StartTimer("t2")
+	StartFileTimer("watched")
+	time.Sleep(20 * time.Millisecond)
+	var config WatchdogConfig = WatchdogConfig{Threshold: 10 * time.Millisecond, Files: true, Action: WATCHDOG_END, Callback: func (StaleTimer) {}}
+	CheckStaleTimers(config)
+	if GetTimerDelta("t1") < 0 || GetTimerOutcome("t1") != OUTCOME_STALE || GetFileTimerOutcome("watched") != OUTCOME_STALE {
+		t.Log("Stale timers were not ended")
+		t.Fail()
+	}
+	for _, timer := range CheckStaleTimers(config) {
+		if timer.Backend == BACKEND_HASHTABLE || timer.Name == "watched" {
+			t.Log("Ended timers are still stale")
+			t.Fail()
+		}
+	}
+	DeleteTimer("t1")
+	DeleteTimer("t2")
+	DeleteFileTimer("watched")
+}
+
+func TestWatchdog3(t *testing.T) {
+	StartTimer("t1")
+	var w *Watchdog = StartWatchdog(WatchdogConfig{Threshold: 5 * time.Millisecond, Interval: time.Millisecond, Action: WATCHDOG_DELETE, Callback: func (StaleTimer) {}})
+	time.Sleep(50 * time.Millisecond)
+	w.Stop()
+	if GetTimerDelta("t1") != -1 {
+		t.Log("Watchdog did not delete the stale timer")
+		t.Fail()
+		DeleteTimer("t1")
+	}
+}
+
+func TestWatchdog4(t *testing.T) {
+	var finished bool = false
+	defer func () {
+			r := recover()
+			if r == nil || !finished {
+				t.Fail()
+			}
+		}()
+	finished = true
+	StartWatchdog(WatchdogConfig{Action: WATCHDOG_REPORT})
+}
+
+func TestWatchdog5(t *testing.T) {
+	StartTimer("t1")
+	defer DeleteTimer("t1")
+	var calls int32 = 0
+	var w *Watchdog = StartWatchdog(WatchdogConfig{Threshold: time.Millisecond, Interval: time.Millisecond, Action: WATCHDOG_REPORT,
+		Callback: func (StaleTimer) {
+			atomic.AddInt32(&calls, 1)
+			panic("callback failed")
+		}})
+	time.Sleep(20 * time.Millisecond)
+	w.Stop()
+	if atomic.LoadInt32(&calls) < 2 {
+		t.Log("Watchdog stopped after a panicking check")
+		t.Fail()
+	}
+
+	var saved string = timerDir
+	defer func () {
+		timerDir = saved
+		if recover() == nil {
+			t.Log("Watchdog on file timers started without a collection")
+			t.Fail()
+		}
+	}()
+	timerDir = ""
+	StartWatchdog(WatchdogConfig{Threshold: time.Second, Files: true})
+}